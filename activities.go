@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/setecrs/wekan-hooks/hooks"
+	"github.com/setecrs/wekan-hooks/random"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// addActivity records a change made to a card in the activities collection,
+// as Wekan does when the change is made by a user, so it is shown in the
+// card and board history. Fields are added to the document. Without a bot
+// user the activity is not recorded, since it would be shown as made by
+// someone else.
+func (cnf config) addActivity(activityType string, card hooks.CardMsg, fields bson.M) error {
+	if cnf.UserID == "" {
+		return nil
+	}
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("activities")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	now := time.Now()
+	activity := bson.M{
+		"_id":          random.ID(),
+		"userId":       cnf.UserID,
+		"activityType": activityType,
+		"boardId":      card.BoardID,
+		"listId":       card.ListID,
+		"swimlaneId":   card.SwimlaneID,
+		"cardId":       card.ID,
+		"cardTitle":    card.Title,
+		"createdAt":    now,
+		"modifiedAt":   now,
+	}
+	for k, v := range fields {
+		activity[k] = v
+	}
+	_, err := coll.InsertOne(ctx, activity)
+	if err != nil {
+		return errors.Wrap(err, "error inserting activity")
+	}
+	return nil
+}
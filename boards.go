@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+
+	"github.com/setecrs/wekan-hooks/hooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (cnf config) findID(collection string, filter interface{}) (id string, ok bool, err error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection(collection)
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	result := coll.FindOne(ctx, filter)
+	idStruct := struct {
+		ID string `bson:"_id"`
+	}{}
+	err = result.Decode(&idStruct)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return idStruct.ID, true, nil
+}
+
+func (cnf config) findIDs(collection string, filter interface{}) ([]string, error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection(collection)
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	cur, err := coll.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	ids := []string{}
+	for cur.Next(ctx) {
+		idStruct := struct {
+			ID string `bson:"_id"`
+		}{}
+		err = cur.Decode(&idStruct)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, idStruct.ID)
+	}
+	return ids, cur.Err()
+}
+
+func (cnf config) FindBoardByID(boardID string) (hooks.Board, error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("boards")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	board := hooks.Board{}
+	err := coll.FindOne(ctx, bson.M{"_id": boardID}).Decode(&board)
+	return board, err
+}
+
+func (cnf config) FindList(boardID, title string) (id string, ok bool, err error) {
+	return cnf.findID("lists", bson.M{"boardId": boardID, "title": title, "archived": bson.M{"$ne": true}})
+}
+
+func (cnf config) FindListByID(listID string) (hooks.List, error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("lists")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	list := hooks.List{}
+	err := coll.FindOne(ctx, bson.M{"_id": listID}).Decode(&list)
+	return list, err
+}
+
+// FindLists returns the lists of the board that are not archived, in the
+// order they are shown.
+func (cnf config) FindLists(boardID string) ([]hooks.List, error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("lists")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	cur, err := coll.Find(
+		ctx,
+		bson.M{"boardId": boardID, "archived": bson.M{"$ne": true}},
+		options.Find().SetSort(bson.M{"sort": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	lists := []hooks.List{}
+	for cur.Next(ctx) {
+		list := hooks.List{}
+		err = cur.Decode(&list)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, cur.Err()
+}
+
+func (cnf config) FindSwimlane(boardID, title string) (id string, ok bool, err error) {
+	return cnf.findID("swimlanes", bson.M{"boardId": boardID, "title": title, "archived": bson.M{"$ne": true}})
+}
+
+func (cnf config) FindSwimlaneByID(swimlaneID string) (hooks.Swimlane, error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("swimlanes")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	swimlane := hooks.Swimlane{}
+	err := coll.FindOne(ctx, bson.M{"_id": swimlaneID}).Decode(&swimlane)
+	return swimlane, err
+}
+
+// FindSwimlanes returns the swimlanes of the board that are not archived, in
+// the order they are shown.
+func (cnf config) FindSwimlanes(boardID string) ([]hooks.Swimlane, error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("swimlanes")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	cur, err := coll.Find(
+		ctx,
+		bson.M{"boardId": boardID, "archived": bson.M{"$ne": true}},
+		options.Find().SetSort(bson.M{"sort": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	swimlanes := []hooks.Swimlane{}
+	for cur.Next(ctx) {
+		swimlane := hooks.Swimlane{}
+		err = cur.Decode(&swimlane)
+		if err != nil {
+			return nil, err
+		}
+		swimlanes = append(swimlanes, swimlane)
+	}
+	return swimlanes, cur.Err()
+}
+
+// firstSwimlane returns the swimlane shown first in the board.
+func (cnf config) firstSwimlane(boardID string) (id string, ok bool, err error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("swimlanes")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	result := coll.FindOne(
+		ctx,
+		bson.M{"boardId": boardID, "archived": bson.M{"$ne": true}},
+		options.FindOne().SetSort(bson.M{"sort": 1}),
+	)
+	idStruct := struct {
+		ID string `bson:"_id"`
+	}{}
+	err = result.Decode(&idStruct)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return idStruct.ID, true, nil
+}
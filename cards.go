@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/setecrs/wekan-hooks/hooks"
+	"github.com/setecrs/wekan-hooks/random"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (cnf config) FindChildren(cardID string) ([]hooks.CardMsg, error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("cards")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	cur, err := coll.Find(ctx, bson.M{"parentId": cardID}, options.Find().SetSort(bson.M{"sort": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	cards := []hooks.CardMsg{}
+	for cur.Next(ctx) {
+		card := hooks.CardMsg{}
+		err = cur.Decode(&card)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, card)
+	}
+	return cards, cur.Err()
+}
+
+// FindDescendants returns the children of a card, their children and so
+// on, nearest first.
+func (cnf config) FindDescendants(cardID string) ([]hooks.CardMsg, error) {
+	return cnf.relatedCards(cardID, []bson.M{
+		{"$graphLookup": bson.M{
+			"from":             "cards",
+			"startWith":        "$_id",
+			"connectFromField": "_id",
+			"connectToField":   "parentId",
+			"as":               "related",
+			"depthField":       "depth",
+		}},
+	}, bson.M{"depth": 1, "sort": 1})
+}
+
+// FindAncestors returns the parent of a card, its grandparent and so on.
+func (cnf config) FindAncestors(cardID string) ([]hooks.CardMsg, error) {
+	return cnf.relatedCards(cardID, []bson.M{
+		{"$graphLookup": bson.M{
+			"from":             "cards",
+			"startWith":        "$parentId",
+			"connectFromField": "parentId",
+			"connectToField":   "_id",
+			"as":               "related",
+			"depthField":       "depth",
+		}},
+	}, bson.M{"depth": 1})
+}
+
+// FindSiblings returns the other children of the parent of a card. Cards
+// without a parent have no siblings.
+func (cnf config) FindSiblings(cardID string) ([]hooks.CardMsg, error) {
+	return cnf.relatedCards(cardID, []bson.M{
+		{"$match": bson.M{"parentId": bson.M{"$nin": []interface{}{"", nil}}}},
+		{"$lookup": bson.M{
+			"from":         "cards",
+			"localField":   "parentId",
+			"foreignField": "parentId",
+			"as":           "related",
+		}},
+	}, bson.M{"sort": 1})
+}
+
+// relatedCards runs stages on the card cardID and returns the cards they
+// collect in the related field, without cardID itself.
+func (cnf config) relatedCards(cardID string, stages []bson.M, sort bson.M) ([]hooks.CardMsg, error) {
+	pipeline := append([]bson.M{{"$match": bson.M{"_id": cardID}}}, stages...)
+	pipeline = append(pipeline,
+		bson.M{"$unwind": "$related"},
+		bson.M{"$replaceRoot": bson.M{"newRoot": "$related"}},
+		bson.M{"$match": bson.M{"_id": bson.M{"$ne": cardID}}},
+		bson.M{"$sort": sort},
+	)
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("cards")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	cur, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	cards := []hooks.CardMsg{}
+	for cur.Next(ctx) {
+		card := hooks.CardMsg{}
+		err = cur.Decode(&card)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, card)
+	}
+	return cards, cur.Err()
+}
+
+// FindCards returns the cards selected by the filter, in the order they are
+// shown.
+func (cnf config) FindCards(filter hooks.CardFilter) ([]hooks.CardMsg, error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("cards")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	cur, err := coll.Find(ctx, cardQuery(filter), options.Find().SetSort(bson.M{"sort": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	cards := []hooks.CardMsg{}
+	for cur.Next(ctx) {
+		card := hooks.CardMsg{}
+		err = cur.Decode(&card)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, card)
+	}
+	return cards, cur.Err()
+}
+
+func cardQuery(filter hooks.CardFilter) bson.M {
+	query := bson.M{}
+	if filter.BoardID != "" {
+		query["boardId"] = filter.BoardID
+	}
+	if filter.ListID != "" {
+		query["listId"] = filter.ListID
+	}
+	if filter.SwimlaneID != "" {
+		query["swimlaneId"] = filter.SwimlaneID
+	}
+	if filter.Archived != nil {
+		query["archived"] = *filter.Archived
+	}
+	if filter.Title != "" {
+		query["title"] = bson.M{"$regex": filter.Title}
+	}
+	if len(filter.CustomFields) > 0 {
+		all := []bson.M{}
+		for id, value := range filter.CustomFields {
+			all = append(all, bson.M{"$elemMatch": bson.M{"_id": id, "value": value}})
+		}
+		query["customFields"] = bson.M{"$all": all}
+	}
+	return query
+}
+
+// MoveCard moves a card to the end of a list. An empty swimlaneID keeps the
+// card in its current swimlane.
+func (cnf config) MoveCard(cardID, listID, swimlaneID string) error {
+	card, err := cnf.FindCard(cardID)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not find card: %s", cardID))
+	}
+	sort, err := cnf.count("cards", bson.M{"listId": listID, "archived": false})
+	if err != nil {
+		return errors.Wrap(err, "error counting cards")
+	}
+	set := bson.M{
+		"listId": listID,
+		"sort":   sort,
+	}
+	if swimlaneID != "" {
+		set["swimlaneId"] = swimlaneID
+	}
+	err = cnf.updateCard(cardID, bson.M{"$set": set})
+	if err != nil {
+		return errors.Wrap(err, "error moving card")
+	}
+	moved := card
+	moved.ListID = listID
+	if swimlaneID != "" {
+		moved.SwimlaneID = swimlaneID
+	}
+	return cnf.addActivity("moveCard", moved, bson.M{
+		"oldListId":     card.ListID,
+		"oldSwimlaneId": card.SwimlaneID,
+	})
+}
+
+// CreateCard inserts a card at the end of a list, with the fields Wekan sets
+// when a user creates one. An empty swimlaneID puts the card in the first
+// swimlane of the board. The card is owned by the bot user, or by the owner
+// of the parent without one.
+func (cnf config) CreateCard(boardID, listID, swimlaneID, title, parentID string) (id string, err error) {
+	if swimlaneID == "" {
+		var ok bool
+		swimlaneID, ok, err = cnf.firstSwimlane(boardID)
+		if err != nil {
+			return "", errors.Wrap(err, "error searching swimlane")
+		}
+		if !ok {
+			return "", fmt.Errorf("board %s has no swimlanes", boardID)
+		}
+	}
+	userID := cnf.UserID
+	if parentID != "" {
+		parent, err := cnf.FindCard(parentID)
+		if err != nil {
+			return "", errors.Wrap(err, fmt.Sprintf("could not find parent card: %s", parentID))
+		}
+		userID = cnf.userID(parent)
+	}
+	if userID == "" {
+		return "", fmt.Errorf("could not create card %s: no bot user and no parent", title)
+	}
+	sort, err := cnf.count("cards", bson.M{"listId": listID, "archived": false})
+	if err != nil {
+		return "", errors.Wrap(err, "error counting cards")
+	}
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("cards")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	now := time.Now()
+	id = random.ID()
+	_, err = coll.InsertOne(ctx, bson.M{
+		"_id":              id,
+		"title":            title,
+		"boardId":          boardID,
+		"listId":           listID,
+		"swimlaneId":       swimlaneID,
+		"parentId":         parentID,
+		"sort":             sort,
+		"archived":         false,
+		"userId":           userID,
+		"members":          []string{},
+		"labelIds":         []string{},
+		"customFields":     []hooks.CustomFieldValue{},
+		"type":             "cardType-card",
+		"linkedId":         "",
+		"createdAt":        now,
+		"modifiedAt":       now,
+		"dateLastActivity": now,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error inserting new card")
+	}
+	card := hooks.CardMsg{
+		ID:         id,
+		Title:      title,
+		BoardID:    boardID,
+		ListID:     listID,
+		SwimlaneID: swimlaneID,
+		UserID:     userID,
+	}
+	err = cnf.addActivity("createCard", card, nil)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// RemoveCard deletes a card and its activities. It is only used for cards
+// created by the hooks whose creation could not be completed.
+func (cnf config) RemoveCard(cardID string) error {
+	db := cnf.MongoClient.Database(cnf.Database)
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	_, err := db.Collection("activities").DeleteMany(ctx, bson.M{"cardId": cardID})
+	if err != nil {
+		return errors.Wrap(err, "error removing activities")
+	}
+	_, err = db.Collection("cards").DeleteOne(ctx, bson.M{"_id": cardID})
+	if err != nil {
+		return errors.Wrap(err, "error removing card")
+	}
+	return nil
+}
+
+// updateCard applies update to a card, also setting the dates Wekan uses to
+// show the last change.
+func (cnf config) updateCard(cardID string, update bson.M) error {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("cards")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	now := time.Now()
+	set, _ := update["$set"].(bson.M)
+	if set == nil {
+		set = bson.M{}
+		update["$set"] = set
+	}
+	set["modifiedAt"] = now
+	set["dateLastActivity"] = now
+	result, err := coll.UpdateOne(ctx, bson.M{"_id": cardID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("card not found: %s", cardID)
+	}
+	return nil
+}
+
+// changeCard reads a card, applies update and records the activity.
+func (cnf config) changeCard(cardID string, update bson.M, activityType string, fields bson.M) error {
+	card, err := cnf.FindCard(cardID)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not find card: %s", cardID))
+	}
+	err = cnf.updateCard(cardID, update)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("error updating card: %s", cardID))
+	}
+	if activityType == "" {
+		return nil
+	}
+	return cnf.addActivity(activityType, card, fields)
+}
+
+func (cnf config) ArchiveCard(cardID string) error {
+	return cnf.changeCard(cardID, bson.M{
+		"$set": bson.M{"archived": true, "archivedAt": time.Now()},
+	}, "archivedCard", nil)
+}
+
+func (cnf config) RestoreCard(cardID string) error {
+	return cnf.changeCard(cardID, bson.M{
+		"$set": bson.M{"archived": false},
+	}, "restoredCard", nil)
+}
+
+func (cnf config) AddLabel(cardID, labelID string) error {
+	return cnf.changeCard(cardID, bson.M{
+		"$addToSet": bson.M{"labelIds": labelID},
+	}, "addedLabel", bson.M{"labelId": labelID})
+}
+
+func (cnf config) RemoveLabel(cardID, labelID string) error {
+	return cnf.changeCard(cardID, bson.M{
+		"$pull": bson.M{"labelIds": labelID},
+	}, "removedLabel", bson.M{"labelId": labelID})
+}
+
+func (cnf config) AddMember(cardID, userID string) error {
+	return cnf.changeCard(cardID, bson.M{
+		"$addToSet": bson.M{"members": userID},
+	}, "joinMember", bson.M{"memberId": userID})
+}
+
+func (cnf config) RemoveMember(cardID, userID string) error {
+	return cnf.changeCard(cardID, bson.M{
+		"$pull": bson.M{"members": userID},
+	}, "unjoinMember", bson.M{"memberId": userID})
+}
+
+func (cnf config) AddAssignee(cardID, userID string) error {
+	return cnf.changeCard(cardID, bson.M{
+		"$addToSet": bson.M{"assignees": userID},
+	}, "joinAssignee", bson.M{"assigneeId": userID})
+}
+
+func (cnf config) RemoveAssignee(cardID, userID string) error {
+	return cnf.changeCard(cardID, bson.M{
+		"$pull": bson.M{"assignees": userID},
+	}, "unjoinAssignee", bson.M{"assigneeId": userID})
+}
+
+// SetDueDate sets the due date of a card. A zero due removes it.
+func (cnf config) SetDueDate(cardID string, due time.Time) error {
+	if due.IsZero() {
+		return cnf.changeCard(cardID, bson.M{
+			"$unset": bson.M{"dueAt": ""},
+		}, "a-dueAt", bson.M{"timeKey": "dueAt"})
+	}
+	return cnf.changeCard(cardID, bson.M{
+		"$set": bson.M{"dueAt": due},
+	}, "a-dueAt", bson.M{"timeKey": "dueAt", "timeValue": due})
+}
+
+// SetTitle renames a card. Wekan does not record an activity for it.
+func (cnf config) SetTitle(cardID, title string) error {
+	return cnf.changeCard(cardID, bson.M{
+		"$set": bson.M{"title": title},
+	}, "", nil)
+}
+
+// SetParent makes a card a child of parentID. An empty parentID makes it a
+// top level card. Wekan does not record an activity for it.
+func (cnf config) SetParent(cardID, parentID string) error {
+	return cnf.changeCard(cardID, bson.M{
+		"$set": bson.M{"parentId": parentID},
+	}, "", nil)
+}
+
+// SetDescription replaces the description of a card. Wekan does not record
+// an activity for it.
+func (cnf config) SetDescription(cardID, description string) error {
+	return cnf.changeCard(cardID, bson.M{
+		"$set": bson.M{"description": description},
+	}, "", nil)
+}
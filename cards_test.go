@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/setecrs/wekan-hooks/hooks"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCardQuery(t *testing.T) {
+	active := false
+	table := []struct {
+		filter hooks.CardFilter
+		expect bson.M
+	}{
+		{hooks.CardFilter{}, bson.M{}},
+		{
+			hooks.CardFilter{BoardID: "b1", ListID: "l1", Archived: &active, Title: "^IPL"},
+			bson.M{"boardId": "b1", "listId": "l1", "archived": false, "title": bson.M{"$regex": "^IPL"}},
+		},
+		{
+			hooks.CardFilter{CustomFields: map[string]interface{}{"ipl": "IPL 123"}},
+			bson.M{"customFields": bson.M{"$all": []bson.M{
+				{"$elemMatch": bson.M{"_id": "ipl", "value": "IPL 123"}},
+			}}},
+		},
+	}
+	for _, x := range table {
+		got := cardQuery(x.filter)
+		if !reflect.DeepEqual(got, x.expect) {
+			t.Errorf("cardQuery(%+v): expect %v, got %v", x.filter, x.expect, got)
+		}
+	}
+}
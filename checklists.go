@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/setecrs/wekan-hooks/hooks"
+	"github.com/setecrs/wekan-hooks/random"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// userID returns the user recorded as owner of the checklists and cards
+// inserted by the hooks: the configured bot user, or the owner of the card.
+// Wekan does not show it as the author of a change, unlike the comments and
+// activities, which require the bot user.
+func (cnf config) userID(card hooks.CardMsg) string {
+	if cnf.UserID != "" {
+		return cnf.UserID
+	}
+	return card.UserID
+}
+
+func (cnf config) FindChecklists(cardID string) ([]hooks.Checklist, error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("checklists")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	cur, err := coll.Find(ctx, bson.M{"cardId": cardID}, options.Find().SetSort(bson.M{"sort": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	checklists := []hooks.Checklist{}
+	for cur.Next(ctx) {
+		c := hooks.Checklist{}
+		err = cur.Decode(&c)
+		if err != nil {
+			return nil, err
+		}
+		checklists = append(checklists, c)
+	}
+	return checklists, cur.Err()
+}
+
+// FindLinkedChecklists returns the checklists, in any card, that track the
+// given cards.
+func (cnf config) FindLinkedChecklists(linkedCardIDs ...string) ([]hooks.Checklist, error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("checklists")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	cur, err := coll.Find(ctx, bson.M{"linkedCardId": bson.M{"$in": linkedCardIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	checklists := []hooks.Checklist{}
+	for cur.Next(ctx) {
+		c := hooks.Checklist{}
+		err = cur.Decode(&c)
+		if err != nil {
+			return nil, err
+		}
+		checklists = append(checklists, c)
+	}
+	return checklists, cur.Err()
+}
+
+// FindChecklistItems returns the items of the given checklists, in order.
+func (cnf config) FindChecklistItems(checklistIDs ...string) ([]hooks.ChecklistItem, error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("checklistItems")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	cur, err := coll.Find(ctx, bson.M{"checklistId": bson.M{"$in": checklistIDs}}, options.Find().SetSort(bson.M{"sort": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	items := []hooks.ChecklistItem{}
+	for cur.Next(ctx) {
+		item := hooks.ChecklistItem{}
+		err = cur.Decode(&item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, cur.Err()
+}
+
+func (cnf config) findChecklist(cardID, checklistTitle string) (id string, ok bool, err error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("checklists")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	result := coll.FindOne(ctx, bson.M{"cardId": cardID, "title": checklistTitle})
+	idStruct := struct {
+		ID string `bson:"_id"`
+	}{}
+	err = result.Decode(&idStruct)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return idStruct.ID, true, nil
+}
+
+func (cnf config) findChecklistItem(checklistID, itemTitle string) (id string, ok bool, err error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("checklistItems")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	result := coll.FindOne(ctx, bson.M{"checklistId": checklistID, "title": itemTitle})
+	idStruct := struct {
+		ID string `bson:"_id"`
+	}{}
+	err = result.Decode(&idStruct)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return idStruct.ID, true, nil
+}
+
+func (cnf config) findChecklistByID(checklistID string) (hooks.Checklist, error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("checklists")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	checklist := hooks.Checklist{}
+	err := coll.FindOne(ctx, bson.M{"_id": checklistID}).Decode(&checklist)
+	return checklist, err
+}
+
+func (cnf config) findChecklistItemByID(itemID string) (hooks.ChecklistItem, error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("checklistItems")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	item := hooks.ChecklistItem{}
+	err := coll.FindOne(ctx, bson.M{"_id": itemID}).Decode(&item)
+	return item, err
+}
+
+func (cnf config) count(collection string, filter interface{}) (int64, error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection(collection)
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	return coll.CountDocuments(ctx, filter)
+}
+
+// CreateChecklist adds a checklist at the end of the card, with the same
+// fields Wekan sets when a user creates one.
+func (cnf config) CreateChecklist(cardID, title string) (id string, err error) {
+	card, err := cnf.FindCard(cardID)
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("could not find card: %s", cardID))
+	}
+	sort, err := cnf.count("checklists", bson.M{"cardId": cardID})
+	if err != nil {
+		return "", errors.Wrap(err, "error counting checklists")
+	}
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("checklists")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	id = random.ID()
+	_, err = coll.InsertOne(ctx, checklistDoc(id, card, title, sort, cnf.userID(card), time.Now()))
+	if err != nil {
+		return "", errors.Wrap(err, "error inserting new checklist")
+	}
+	return id, nil
+}
+
+// checklistDoc returns a new checklist at position sort of the card.
+func checklistDoc(id string, card hooks.CardMsg, title string, sort int64, userID string, now time.Time) bson.M {
+	return bson.M{
+		"_id":        id,
+		"cardId":     card.ID,
+		"boardId":    card.BoardID,
+		"title":      title,
+		"sort":       sort,
+		"userId":     userID,
+		"createdAt":  now,
+		"modifiedAt": now,
+	}
+}
+
+func (cnf config) RenameChecklist(checklistID, title string) error {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("checklists")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	_, err := coll.UpdateOne(ctx, bson.M{"_id": checklistID}, bson.M{"$set": bson.M{"title": title, "modifiedAt": time.Now()}})
+	if err != nil {
+		return errors.Wrap(err, "error renaming checklist")
+	}
+	return nil
+}
+
+// LinkChecklist records in the checklist the ID of the card it tracks, so it
+// can be found again after the card is renamed.
+func (cnf config) LinkChecklist(checklistID, linkedCardID string) error {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("checklists")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	_, err := coll.UpdateOne(ctx, bson.M{"_id": checklistID}, bson.M{"$set": bson.M{"linkedCardId": linkedCardID}})
+	if err != nil {
+		return errors.Wrap(err, "error linking checklist")
+	}
+	return nil
+}
+
+// MoveChecklist moves a checklist and its items to the end of another card.
+func (cnf config) MoveChecklist(checklistID, cardID string) error {
+	card, err := cnf.FindCard(cardID)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not find card: %s", cardID))
+	}
+	sort, err := cnf.count("checklists", bson.M{"cardId": cardID})
+	if err != nil {
+		return errors.Wrap(err, "error counting checklists")
+	}
+	db := cnf.MongoClient.Database(cnf.Database)
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	_, err = db.Collection("checklists").UpdateOne(
+		ctx,
+		bson.M{"_id": checklistID},
+		bson.M{"$set": bson.M{"cardId": cardID, "boardId": card.BoardID, "sort": sort, "modifiedAt": time.Now()}},
+	)
+	if err != nil {
+		return errors.Wrap(err, "error moving checklist")
+	}
+	_, err = db.Collection("checklistItems").UpdateMany(
+		ctx,
+		bson.M{"checklistId": checklistID},
+		bson.M{"$set": bson.M{"cardId": cardID, "boardId": card.BoardID}},
+	)
+	if err != nil {
+		return errors.Wrap(err, "error moving checklistItems")
+	}
+	return nil
+}
+
+// RemoveChecklist removes a checklist and its items.
+func (cnf config) RemoveChecklist(checklistID string) error {
+	db := cnf.MongoClient.Database(cnf.Database)
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	_, err := db.Collection("checklistItems").DeleteMany(ctx, bson.M{"checklistId": checklistID})
+	if err != nil {
+		return errors.Wrap(err, "error removing checklistItems")
+	}
+	_, err = db.Collection("checklists").DeleteOne(ctx, bson.M{"_id": checklistID})
+	if err != nil {
+		return errors.Wrap(err, "error removing checklist")
+	}
+	return nil
+}
+
+// AddChecklistItem appends an item to a checklist.
+func (cnf config) AddChecklistItem(checklistID, title string, isFinished bool) (id string, err error) {
+	checklist, err := cnf.findChecklistByID(checklistID)
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("could not find checklist: %s", checklistID))
+	}
+	card, err := cnf.FindCard(checklist.CardID)
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("could not find card: %s", checklist.CardID))
+	}
+	sort, err := cnf.count("checklistItems", bson.M{"checklistId": checklistID})
+	if err != nil {
+		return "", errors.Wrap(err, "error counting checklistItems")
+	}
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("checklistItems")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	id = random.ID()
+	_, err = coll.InsertOne(ctx, checklistItemDoc(id, card, checklistID, title, sort, isFinished, cnf.userID(card), time.Now()))
+	if err != nil {
+		return "", errors.Wrap(err, "error inserting new checklistItem")
+	}
+	return id, cnf.updateChecklistFinished(checklistID)
+}
+
+// checklistItemDoc returns a new item at position sort of the checklist.
+func checklistItemDoc(id string, card hooks.CardMsg, checklistID, title string, sort int64, isFinished bool, userID string, now time.Time) bson.M {
+	return bson.M{
+		"_id":         id,
+		"cardId":      card.ID,
+		"boardId":     card.BoardID,
+		"checklistId": checklistID,
+		"title":       title,
+		"sort":        sort,
+		"isFinished":  isFinished,
+		"userId":      userID,
+		"createdAt":   now,
+		"modifiedAt":  now,
+	}
+}
+
+func (cnf config) RenameChecklistItem(itemID, title string) error {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("checklistItems")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	_, err := coll.UpdateOne(ctx, bson.M{"_id": itemID}, bson.M{"$set": bson.M{"title": title, "modifiedAt": time.Now()}})
+	if err != nil {
+		return errors.Wrap(err, "error renaming checklistItem")
+	}
+	return nil
+}
+
+func (cnf config) RemoveChecklistItem(itemID string) error {
+	item, err := cnf.findChecklistItemByID(itemID)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not find checklistItem: %s", itemID))
+	}
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("checklistItems")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	_, err = coll.DeleteOne(ctx, bson.M{"_id": itemID})
+	if err != nil {
+		return errors.Wrap(err, "error removing checklistItem")
+	}
+	return cnf.updateChecklistFinished(item.ChecklistID)
+}
+
+func (cnf config) SetChecklistItemFinished(itemID string, isFinished bool) error {
+	item, err := cnf.findChecklistItemByID(itemID)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not find checklistItem: %s", itemID))
+	}
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("checklistItems")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	_, err = coll.UpdateOne(ctx, bson.M{"_id": itemID}, bson.M{"$set": bson.M{"isFinished": isFinished, "modifiedAt": time.Now()}})
+	if err != nil {
+		return errors.Wrap(err, "error updating checklistItem")
+	}
+	return cnf.updateChecklistFinished(item.ChecklistID)
+}
+
+// LinkChecklistItem records in the item the ID of the card created from it.
+func (cnf config) LinkChecklistItem(itemID, linkedCardID string) error {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("checklistItems")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	_, err := coll.UpdateOne(ctx, bson.M{"_id": itemID}, bson.M{"$set": bson.M{"linkedCardId": linkedCardID}})
+	if err != nil {
+		return errors.Wrap(err, "error linking checklistItem")
+	}
+	return nil
+}
+
+// ClaimChecklistItem links the item only if it is not linked yet, in a
+// single update, so concurrent events do not both create a card from it.
+func (cnf config) ClaimChecklistItem(itemID, linkedCardID string) (ok bool, err error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("checklistItems")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	result, err := coll.UpdateOne(
+		ctx,
+		bson.M{"_id": itemID, "$or": []bson.M{
+			{"linkedCardId": bson.M{"$exists": false}},
+			{"linkedCardId": ""},
+		}},
+		bson.M{"$set": bson.M{"linkedCardId": linkedCardID}},
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "error claiming checklistItem")
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// updateChecklistFinished sets finishedAt when every item of the checklist is
+// finished and unsets it otherwise, as Wekan does.
+func (cnf config) updateChecklistFinished(checklistID string) error {
+	total, err := cnf.count("checklistItems", bson.M{"checklistId": checklistID})
+	if err != nil {
+		return errors.Wrap(err, "error counting checklistItems")
+	}
+	finished, err := cnf.count("checklistItems", bson.M{"checklistId": checklistID, "isFinished": true})
+	if err != nil {
+		return errors.Wrap(err, "error counting checklistItems")
+	}
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("checklists")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	filter, update := finishedUpdate(checklistID, total, finished, time.Now())
+	_, err = coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return errors.Wrap(err, "error updating checklist finishedAt")
+	}
+	return nil
+}
+
+// finishedUpdate returns the update of finishedAt of a checklist with total
+// items, of which finished are finished. The filter matches only checklists
+// whose finishedAt changes, so the first finish time is kept.
+func finishedUpdate(checklistID string, total, finished int64, now time.Time) (filter, update bson.M) {
+	if total > 0 && finished == total {
+		return bson.M{"_id": checklistID, "finishedAt": nil},
+			bson.M{"$set": bson.M{"finishedAt": now, "modifiedAt": now}}
+	}
+	return bson.M{"_id": checklistID, "finishedAt": bson.M{"$ne": nil}},
+		bson.M{"$unset": bson.M{"finishedAt": ""}, "$set": bson.M{"modifiedAt": now}}
+}
+
+// SetCheckListItem finds or creates the checklist and the item by their
+// titles and sets whether the item is finished.
+func (cnf config) SetCheckListItem(cardID string, checklistTitle string, itemTitle string, isFinished bool) error {
+	chklstID, ok, err := cnf.findChecklist(cardID, checklistTitle)
+	if err != nil {
+		return errors.Wrap(err, "error finding checklist")
+	}
+	if !ok {
+		chklstID, err = cnf.CreateChecklist(cardID, checklistTitle)
+		if err != nil {
+			return errors.Wrap(err, "error creating checklist")
+		}
+	}
+	itemID, ok, err := cnf.findChecklistItem(chklstID, itemTitle)
+	if err != nil {
+		return errors.Wrap(err, "error finding checklistItem")
+	}
+	if !ok {
+		_, err = cnf.AddChecklistItem(chklstID, itemTitle, isFinished)
+		if err != nil {
+			return errors.Wrap(err, "error inserting checklistItem")
+		}
+		return nil
+	}
+	err = cnf.SetChecklistItemFinished(itemID, isFinished)
+	if err != nil {
+		return errors.Wrap(err, "error updating checklistItem")
+	}
+	return nil
+}
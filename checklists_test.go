@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/setecrs/wekan-hooks/hooks"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestChecklistDocs(t *testing.T) {
+	now := time.Now()
+	card := hooks.CardMsg{ID: "c1", BoardID: "b1", UserID: "owner"}
+
+	got := checklistDoc("k1", card, "Materiais", 2, "bot", now)
+	expect := bson.M{
+		"_id":        "k1",
+		"cardId":     "c1",
+		"boardId":    "b1",
+		"title":      "Materiais",
+		"sort":       int64(2),
+		"userId":     "bot",
+		"createdAt":  now,
+		"modifiedAt": now,
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("checklistDoc: expect %v, got %v", expect, got)
+	}
+
+	got = checklistItemDoc("i1", card, "k1", "Pronto", 3, true, "bot", now)
+	expect = bson.M{
+		"_id":         "i1",
+		"cardId":      "c1",
+		"boardId":     "b1",
+		"checklistId": "k1",
+		"title":       "Pronto",
+		"sort":        int64(3),
+		"isFinished":  true,
+		"userId":      "bot",
+		"createdAt":   now,
+		"modifiedAt":  now,
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("checklistItemDoc: expect %v, got %v", expect, got)
+	}
+}
+
+func TestUserID(t *testing.T) {
+	card := hooks.CardMsg{ID: "c1", UserID: "owner"}
+	if got := (config{}).userID(card); got != "owner" {
+		t.Errorf("expect owner of the card, got '%s'", got)
+	}
+	if got := (config{UserID: "bot"}).userID(card); got != "bot" {
+		t.Errorf("expect bot user, got '%s'", got)
+	}
+}
+
+func TestFinishedUpdate(t *testing.T) {
+	now := time.Now()
+	table := []struct {
+		total, finished int64
+		filter, update  bson.M
+	}{
+		{2, 2,
+			bson.M{"_id": "k1", "finishedAt": nil},
+			bson.M{"$set": bson.M{"finishedAt": now, "modifiedAt": now}}},
+		{2, 1,
+			bson.M{"_id": "k1", "finishedAt": bson.M{"$ne": nil}},
+			bson.M{"$unset": bson.M{"finishedAt": ""}, "$set": bson.M{"modifiedAt": now}}},
+		{0, 0,
+			bson.M{"_id": "k1", "finishedAt": bson.M{"$ne": nil}},
+			bson.M{"$unset": bson.M{"finishedAt": ""}, "$set": bson.M{"modifiedAt": now}}},
+	}
+	for _, x := range table {
+		filter, update := finishedUpdate("k1", x.total, x.finished, now)
+		if !reflect.DeepEqual(filter, x.filter) || !reflect.DeepEqual(update, x.update) {
+			t.Errorf("%d/%d: expect %v %v, got %v %v", x.finished, x.total, x.filter, x.update, filter, update)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/setecrs/wekan-hooks/random"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// AddComment posts a comment to a card as the bot user.
+func (cnf config) AddComment(cardID, text string) (id string, err error) {
+	if cnf.UserID == "" {
+		return "", fmt.Errorf("could not post comment to card %s: no bot user", cardID)
+	}
+	card, err := cnf.FindCard(cardID)
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("could not find card: %s", cardID))
+	}
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("card_comments")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	now := time.Now()
+	id = random.ID()
+	_, err = coll.InsertOne(ctx, bson.M{
+		"_id":        id,
+		"boardId":    card.BoardID,
+		"cardId":     card.ID,
+		"userId":     cnf.UserID,
+		"text":       text,
+		"createdAt":  now,
+		"modifiedAt": now,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error inserting comment")
+	}
+	err = cnf.addActivity("addComment", card, bson.M{"commentId": id})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (cnf config) CommentTemplate(name string) *template.Template {
+	return cnf.Comments[name]
+}
@@ -0,0 +1,64 @@
+package dedup
+
+import (
+	"sync"
+	"time"
+)
+
+// Store remembers event identities for a limited time, so an event
+// delivered more than once is only processed once.
+type Store struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	seen map[string]time.Time
+	now  func() time.Time
+}
+
+// New returns a Store that forgets events after ttl.
+func New(ttl time.Duration) *Store {
+	return &Store{
+		ttl:  ttl,
+		seen: make(map[string]time.Time),
+		now:  time.Now,
+	}
+}
+
+// Claim records id and reports whether it was not recorded yet, in a single
+// step, so concurrent deliveries of an event are processed only once. An
+// event that fails should be released, so a new delivery is processed.
+func (s *Store) Claim(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.expire()
+	if _, ok := s.seen[id]; ok {
+		return false
+	}
+	s.seen[id] = now.Add(s.ttl)
+	return true
+}
+
+// Release forgets id, claimed by an event that failed.
+func (s *Store) Release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.seen, id)
+}
+
+// expire drops expired entries and returns the current time. s.mu must be
+// held.
+func (s *Store) expire() time.Time {
+	now := s.now()
+	for k, expires := range s.seen {
+		if !now.Before(expires) {
+			delete(s.seen, k)
+		}
+	}
+	return now
+}
+
+// Len returns the number of entries currently stored.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.seen)
+}
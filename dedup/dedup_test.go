@@ -0,0 +1,64 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClaim(t *testing.T) {
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	s := New(time.Minute)
+	s.now = func() time.Time { return now }
+
+	if !s.Claim("a") {
+		t.Errorf("expect first claim of 'a'")
+	}
+	if s.Claim("a") {
+		t.Errorf("expect 'a' already claimed")
+	}
+	s.Release("a")
+	if !s.Claim("a") {
+		t.Errorf("expect 'a' claimed again after release")
+	}
+
+	now = now.Add(30 * time.Second)
+	if !s.Claim("b") {
+		t.Errorf("expect first claim of 'b'")
+	}
+	if s.Claim("a") {
+		t.Errorf("expect 'a' claimed before ttl")
+	}
+
+	now = now.Add(30 * time.Second)
+	if !s.Claim("a") {
+		t.Errorf("expect 'a' claimed again after ttl")
+	}
+	if s.Claim("b") {
+		t.Errorf("expect 'b' claimed before ttl")
+	}
+
+	now = now.Add(time.Minute)
+	s.Claim("c")
+	if s.Len() != 1 {
+		t.Errorf("expect expired entries to be dropped, got %d entries", s.Len())
+	}
+}
+
+func TestClaimConcurrent(t *testing.T) {
+	s := New(time.Minute)
+	claimed := make(chan bool)
+	for i := 0; i < 10; i++ {
+		go func() {
+			claimed <- s.Claim("a")
+		}()
+	}
+	n := 0
+	for i := 0; i < 10; i++ {
+		if <-claimed {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("expect one claim, got %d", n)
+	}
+}
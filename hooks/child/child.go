@@ -3,10 +3,38 @@ package child
 import (
 	"log"
 
+	"github.com/pkg/errors"
+
 	hooks "github.com/setecrs/wekan-hooks/hooks"
 )
 
-func Creation(act string, cardId string, ops hooks.Operations) error {
+// DefaultDone is the item of the parent checklist checked when the child
+// card is archived, if no other is configured.
+const DefaultDone = "Pronto"
+
+// Tracker has the hooks that keep, in the parent card, one checklist for
+// each child card.
+type Tracker struct {
+	// Done is the item of the checklist checked when the child card is
+	// archived, and counted as done by MoveParent and Rollup.
+	Done string
+	// Stages, if set, are the items of the checklist. Done is then the item
+	// of the last stage.
+	Stages []Stage
+}
+
+// NewTracker returns a Tracker with the stages, if any, or else with the
+// done item. An empty done means DefaultDone.
+func NewTracker(done string, stages []Stage) Tracker {
+	if len(stages) > 0 {
+		done = stages[len(stages)-1].Item
+	} else if done == "" {
+		done = DefaultDone
+	}
+	return Tracker{Done: done, Stages: stages}
+}
+
+func (t Tracker) Creation(act string, cardId string, ops hooks.Operations) error {
 	if act != hooks.ActCreateCard {
 		return nil
 	}
@@ -18,10 +46,17 @@ func Creation(act string, cardId string, ops hooks.Operations) error {
 		return nil
 	}
 	log.Println("child.Creation")
-	return ops.SetCheckListItem(card.ParentID, card.Title, "Pronto", false)
+	checklist, err := parentChecklist(ops, card)
+	if err != nil {
+		return err
+	}
+	if len(t.Stages) > 0 {
+		return applyStages(ops, t.Stages, card, checklist)
+	}
+	return setItem(ops, checklist.ID, t.Done, false)
 }
 
-func Archive(act string, cardId string, ops hooks.Operations) error {
+func (t Tracker) Archive(act string, cardId string, ops hooks.Operations) error {
 	if act != hooks.ActArchivedCard {
 		return nil
 	}
@@ -33,5 +68,245 @@ func Archive(act string, cardId string, ops hooks.Operations) error {
 		return nil
 	}
 	log.Println("child.Archive")
-	return ops.SetCheckListItem(card.ParentID, card.Title, "Pronto", true)
+	checklist, err := parentChecklist(ops, card)
+	if err != nil {
+		return err
+	}
+	if len(t.Stages) > 0 {
+		// an archived card went through every stage
+		return checkStages(ops, t.Stages, checklist.ID, len(t.Stages)-1)
+	}
+	return setItem(ops, checklist.ID, t.Done, true)
+}
+
+func (t Tracker) Restore(act string, cardId string, ops hooks.Operations) error {
+	if act != hooks.ActRestoredCard {
+		return nil
+	}
+	card, err := ops.FindCard(cardId)
+	if err != nil {
+		return err
+	}
+	if card.ParentID == "" {
+		return nil
+	}
+	log.Println("child.Restore")
+	checklist, err := parentChecklist(ops, card)
+	if err != nil {
+		return err
+	}
+	if len(t.Stages) > 0 {
+		current, err := currentStage(ops, t.Stages, card)
+		if err != nil {
+			return err
+		}
+		if current >= 0 {
+			// the stages of the list of the card
+			return checkStages(ops, t.Stages, checklist.ID, current)
+		}
+	}
+	return setItem(ops, checklist.ID, t.Done, false)
+}
+
+// Deletion removes the checklists that tracked a deleted card.
+func (t Tracker) Deletion(act string, cardId string, ops hooks.Operations) error {
+	if act != hooks.ActDeleteCard {
+		return nil
+	}
+	linked, err := ops.FindLinkedChecklists(cardId)
+	if err != nil {
+		return errors.Wrap(err, "could not find linked checklists")
+	}
+	for _, c := range linked {
+		log.Println("child.Deletion")
+		err = ops.RemoveChecklist(c.ID)
+		if err != nil {
+			return err
+		}
+		err = t.updateAncestorsProgress(ops, c.CardID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reparent moves the checklist that tracks the child card to its new
+// parent, or removes it if the card has no parent anymore. Wekan does not
+// notify parent changes, so it runs on any act.
+func (t Tracker) Reparent(act string, cardId string, ops hooks.Operations) error {
+	return t.reparent(act, cardId, ops, nil)
+}
+
+// OnReparent returns a hook like Reparent which also runs then for the card,
+// with the act it received, when the card moved to another parent.
+func (t Tracker) OnReparent(then hooks.Hooker) hooks.Hooker {
+	return func(act string, cardId string, ops hooks.Operations) error {
+		return t.reparent(act, cardId, ops, then)
+	}
+}
+
+func (t Tracker) reparent(act string, cardId string, ops hooks.Operations, then hooks.Hooker) error {
+	if act == hooks.ActDeleteCard || cardId == "" {
+		return nil
+	}
+	card, err := ops.FindCard(cardId)
+	if err != nil {
+		return err
+	}
+	linked, err := ops.FindLinkedChecklists(card.ID)
+	if err != nil {
+		return errors.Wrap(err, "could not find linked checklists")
+	}
+	found, moved := false, false
+	for _, c := range linked {
+		if c.CardID == card.ParentID {
+			found = true
+		} else {
+			moved = true
+		}
+	}
+	if moved && card.ParentID != "" && then != nil {
+		// before the checklists, so a failure runs it again on the next act
+		err = then(act, card.ID, ops)
+		if err != nil {
+			return err
+		}
+	}
+	for _, c := range linked {
+		if c.CardID == card.ParentID {
+			continue
+		}
+		if card.ParentID == "" || found {
+			log.Println("child.Reparent: removing checklist from", c.CardID)
+			err = ops.RemoveChecklist(c.ID)
+		} else {
+			log.Println("child.Reparent: moving checklist from", c.CardID)
+			err = ops.MoveChecklist(c.ID, card.ParentID)
+			found = true
+		}
+		if err != nil {
+			return err
+		}
+		err = t.updateAncestorsProgress(ops, c.CardID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rename keeps the title of the parent checklist equal to the title of the
+// child card. Wekan does not notify title changes, so it runs on any act.
+func Rename(act string, cardId string, ops hooks.Operations) error {
+	if act == hooks.ActDeleteCard || cardId == "" {
+		return nil
+	}
+	card, err := ops.FindCard(cardId)
+	if err != nil {
+		return err
+	}
+	if card.ParentID == "" {
+		return nil
+	}
+	checklist, ok, err := findParentChecklist(ops, card)
+	if err != nil || !ok {
+		return err
+	}
+	if checklist.Title == card.Title {
+		return nil
+	}
+	log.Println("child.Rename")
+	return ops.RenameChecklist(checklist.ID, card.Title)
+}
+
+// findParentChecklist returns the checklist in the parent card that tracks
+// the child card. Checklists created before they were linked by ID are
+// found by title and linked.
+func findParentChecklist(ops hooks.Operations, card hooks.CardMsg) (hooks.Checklist, bool, error) {
+	linked, err := ops.FindLinkedChecklists(card.ID)
+	if err != nil {
+		return hooks.Checklist{}, false, errors.Wrap(err, "could not find linked checklists")
+	}
+	for _, c := range linked {
+		if c.CardID == card.ParentID {
+			return c, true, nil
+		}
+	}
+	checklists, err := ops.FindChecklists(card.ParentID)
+	if err != nil {
+		return hooks.Checklist{}, false, errors.Wrap(err, "could not find parent checklists")
+	}
+	for _, c := range checklists {
+		if c.LinkedCardID == "" && c.Title == card.Title {
+			err = ops.LinkChecklist(c.ID, card.ID)
+			if err != nil {
+				return hooks.Checklist{}, false, err
+			}
+			c.LinkedCardID = card.ID
+			return c, true, nil
+		}
+	}
+	return hooks.Checklist{}, false, nil
+}
+
+// parentChecklist is like findParentChecklist, but creates the checklist if
+// it does not exist and renames it if the child was renamed.
+func parentChecklist(ops hooks.Operations, card hooks.CardMsg) (hooks.Checklist, error) {
+	checklist, ok, err := findParentChecklist(ops, card)
+	if err != nil {
+		return hooks.Checklist{}, err
+	}
+	if !ok {
+		id, err := ops.CreateChecklist(card.ParentID, card.Title)
+		if err != nil {
+			return hooks.Checklist{}, errors.Wrap(err, "could not create parent checklist")
+		}
+		err = ops.LinkChecklist(id, card.ID)
+		if err != nil {
+			return hooks.Checklist{}, err
+		}
+		return hooks.Checklist{ID: id, Title: card.Title, CardID: card.ParentID, LinkedCardID: card.ID}, nil
+	}
+	if checklist.Title != card.Title {
+		err = ops.RenameChecklist(checklist.ID, card.Title)
+		if err != nil {
+			return hooks.Checklist{}, err
+		}
+		checklist.Title = card.Title
+	}
+	return checklist, nil
+}
+
+// setItem finds or creates an item by title and sets whether it is finished.
+func setItem(ops hooks.Operations, checklistID, title string, isFinished bool) error {
+	items, err := ops.FindChecklistItems(checklistID)
+	if err != nil {
+		return errors.Wrap(err, "could not find checklist items")
+	}
+	for _, item := range items {
+		if item.Title == title {
+			if item.IsFinished == isFinished {
+				return nil
+			}
+			return ops.SetChecklistItemFinished(item.ID, isFinished)
+		}
+	}
+	_, err = ops.AddChecklistItem(checklistID, title, isFinished)
+	return err
+}
+
+// itemFinished reports whether the checklist has a finished item with the
+// given title.
+func itemFinished(ops hooks.Operations, checklistID, title string) (bool, error) {
+	items, err := ops.FindChecklistItems(checklistID)
+	if err != nil {
+		return false, errors.Wrap(err, "could not find checklist items")
+	}
+	for _, item := range items {
+		if item.Title == title && item.IsFinished {
+			return true, nil
+		}
+	}
+	return false, nil
 }
@@ -0,0 +1,176 @@
+package child
+
+import (
+	"reflect"
+	"testing"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+	"github.com/setecrs/wekan-hooks/hooks/hookstest"
+)
+
+// tracker has the default done item.
+var tracker = NewTracker("", nil)
+
+func TestCreationArchive(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddCard(hooks.CardMsg{ID: "parent", Title: "IPL 1"})
+	ops.AddCard(hooks.CardMsg{ID: "child", Title: "Material 1", ParentID: "parent"})
+
+	err := tracker.Creation(hooks.ActCreateCard, "child", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]bool{DefaultDone: false}
+	if got := ops.Items("parent", "Material 1"); !reflect.DeepEqual(got, expect) {
+		t.Errorf("after creation expect: %v, got %v", expect, got)
+	}
+
+	err = tracker.Archive(hooks.ActArchivedCard, "child", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = map[string]bool{DefaultDone: true}
+	if got := ops.Items("parent", "Material 1"); !reflect.DeepEqual(got, expect) {
+		t.Errorf("after archive expect: %v, got %v", expect, got)
+	}
+}
+
+func TestRename(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddCard(hooks.CardMsg{ID: "parent", Title: "IPL 1"})
+	ops.AddCard(hooks.CardMsg{ID: "child", Title: "Material 1", ParentID: "parent"})
+
+	err := tracker.Creation(hooks.ActCreateCard, "child", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops.Cards["child"].Title = "Material 2"
+	err = Rename(hooks.ActMoveCard, "child", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ops.Items("parent", "Material 1"); got != nil {
+		t.Errorf("expect old checklist to be renamed, got %v", got)
+	}
+
+	err = tracker.Archive(hooks.ActArchivedCard, "child", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]bool{DefaultDone: true}
+	if got := ops.Items("parent", "Material 2"); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect: %v, got %v", expect, got)
+	}
+	if len(ops.Checklists) != 1 {
+		t.Errorf("expect 1 checklist, got %d", len(ops.Checklists))
+	}
+}
+
+func TestLegacyChecklistIsLinked(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddCard(hooks.CardMsg{ID: "parent", Title: "IPL 1"})
+	ops.AddCard(hooks.CardMsg{ID: "child", Title: "Material 1", ParentID: "parent"})
+	id, _ := ops.CreateChecklist("parent", "Material 1")
+
+	err := tracker.Archive(hooks.ActArchivedCard, "child", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops.Checklists) != 1 {
+		t.Fatalf("expect 1 checklist, got %d", len(ops.Checklists))
+	}
+	if got := ops.Checklists[id].LinkedCardID; got != "child" {
+		t.Errorf("expect checklist linked to 'child', got '%s'", got)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddCard(hooks.CardMsg{ID: "parent", Title: "IPL 1"})
+	ops.AddCard(hooks.CardMsg{ID: "child", Title: "Material 1", ParentID: "parent"})
+
+	for _, act := range []string{hooks.ActCreateCard, hooks.ActArchivedCard, hooks.ActRestoredCard} {
+		for _, h := range []hooks.Hooker{tracker.Creation, tracker.Archive, tracker.Restore} {
+			err := h(act, "child", ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	expect := map[string]bool{DefaultDone: false}
+	if got := ops.Items("parent", "Material 1"); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect: %v, got %v", expect, got)
+	}
+}
+
+func TestDeletion(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddCard(hooks.CardMsg{ID: "parent", Title: "IPL 1"})
+	ops.AddCard(hooks.CardMsg{ID: "child", Title: "Material 1", ParentID: "parent"})
+	err := tracker.Creation(hooks.ActCreateCard, "child", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(ops.Cards, "child")
+	for _, h := range []hooks.Hooker{tracker.Deletion, tracker.Reparent, Rename} {
+		err = h(hooks.ActDeleteCard, "child", ops)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(ops.Checklists) != 0 || len(ops.ChecklistItems) != 0 {
+		t.Errorf("expect no checklists left, got %d checklists and %d items", len(ops.Checklists), len(ops.ChecklistItems))
+	}
+}
+
+func TestReparent(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddCard(hooks.CardMsg{ID: "old", Title: "IPL 1"})
+	ops.AddCard(hooks.CardMsg{ID: "new", Title: "IPL 2"})
+	ops.AddCard(hooks.CardMsg{ID: "child", Title: "Material 1", ParentID: "old"})
+	err := tracker.Archive(hooks.ActArchivedCard, "child", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops.Cards["child"].ParentID = "new"
+	err = tracker.Reparent(hooks.ActMoveCard, "child", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ops.Items("old", "Material 1"); got != nil {
+		t.Errorf("expect checklist removed from old parent, got %v", got)
+	}
+	expect := map[string]bool{DefaultDone: true}
+	if got := ops.Items("new", "Material 1"); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect: %v, got %v", expect, got)
+	}
+
+	ops.Cards["child"].ParentID = ""
+	err = tracker.Reparent(hooks.ActMoveCard, "child", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops.Checklists) != 0 {
+		t.Errorf("expect no checklists left, got %d", len(ops.Checklists))
+	}
+}
+
+func TestTrackerDone(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddCard(hooks.CardMsg{ID: "parent", Title: "IPL 1"})
+	ops.AddCard(hooks.CardMsg{ID: "child", Title: "Material 1", ParentID: "parent"})
+	tracker := NewTracker("Concluido", nil)
+	for _, act := range []string{hooks.ActCreateCard, hooks.ActArchivedCard} {
+		for _, h := range []hooks.Hooker{tracker.Creation, tracker.Archive} {
+			err := h(act, "child", ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	expect := map[string]bool{"Concluido": true}
+	if got := ops.Items("parent", "Material 1"); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect: %v, got %v", expect, got)
+	}
+}
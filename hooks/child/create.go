@@ -0,0 +1,365 @@
+package child
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+)
+
+// CreateChildrenRule describes how child cards are created from the items of
+// a checklist, or from the lines of a custom field, of the parent card.
+type CreateChildrenRule struct {
+	// Checklist is the title of the checklist of the parent card. Adding
+	// the checklist, or items to it, creates the children.
+	Checklist string `json:"checklist"`
+	// ItemsField, if set, is the name of a custom field of the parent card
+	// that lists the children, one per line. Setting the field creates the
+	// children.
+	ItemsField string `json:"itemsField"`
+	// Label, if set, is the name of a label that also creates the children
+	// when applied to the parent card, for example when the checklist or the
+	// field were filled before the rule.
+	Label string `json:"label"`
+	// Board, List and Swimlane are the titles where the children are
+	// created. An empty Swimlane means the first swimlane of the board.
+	Board    string `json:"board"`
+	List     string `json:"list"`
+	Swimlane string `json:"swimlane"`
+	// Fields are the names of the custom fields copied from the parent.
+	Fields []string `json:"fields"`
+	// ItemField, if set, is the custom field that receives the position of
+	// the item in the checklist or in the list of the parent field.
+	ItemField string `json:"itemField"`
+}
+
+// CreateChildren returns a hook that creates one child card for each item
+// of the checklist, or each line of the custom field, of the parent card.
+// Each checklist item is claimed before its card is created and linked to
+// it, and each line is matched to a child with its title, so no child is
+// created twice.
+func (t Tracker) CreateChildren(rule CreateChildrenRule) hooks.Hooker {
+	// lines of the field can not be claimed in the database, so the events
+	// of this hook that read them run one at a time
+	var fieldMu sync.Mutex
+	return func(act string, cardId string, ops hooks.Operations) error {
+		fromChecklist, fromField := false, false
+		switch act {
+		case hooks.ActAddChecklist,
+			hooks.ActAddChecklistItem:
+			fromChecklist = rule.Checklist != ""
+		case hooks.ActSetCustomField:
+			fromField = rule.ItemsField != ""
+		case hooks.ActAddedLabel:
+			fromChecklist = rule.Label != "" && rule.Checklist != ""
+			fromField = rule.Label != "" && rule.ItemsField != ""
+		}
+		if !fromChecklist && !fromField {
+			return nil
+		}
+		card, err := ops.FindCard(cardId)
+		if err != nil {
+			return err
+		}
+		if act == hooks.ActAddedLabel {
+			ok, err := hasLabel(ops, card, rule.Label)
+			if err != nil || !ok {
+				return err
+			}
+		}
+		if fromChecklist {
+			err = t.createFromChecklists(ops, rule, card)
+			if err != nil {
+				return err
+			}
+		}
+		if fromField {
+			fieldMu.Lock()
+			defer fieldMu.Unlock()
+			return t.createFromField(ops, rule, card)
+		}
+		return nil
+	}
+}
+
+// pendingLink marks a checklist item claimed by an event that is creating
+// its card. An item left pending by a crash is not created again until its
+// linkedCardId is cleared.
+const pendingLink = "pending"
+
+func hasLabel(ops hooks.Operations, card hooks.CardMsg, name string) (bool, error) {
+	board, err := ops.FindBoardByID(card.BoardID)
+	if err != nil {
+		return false, errors.Wrap(err, fmt.Sprintf("could not find board: %s", card.BoardID))
+	}
+	for _, l := range board.Labels {
+		if l.Name != name {
+			continue
+		}
+		for _, id := range card.LabelIDs {
+			if id == l.ID {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (t Tracker) createFromChecklists(ops hooks.Operations, rule CreateChildrenRule, parent hooks.CardMsg) error {
+	checklists, err := ops.FindChecklists(parent.ID)
+	if err != nil {
+		return errors.Wrap(err, "could not find checklists")
+	}
+	for _, c := range checklists {
+		if c.Title != rule.Checklist {
+			continue
+		}
+		err = t.createChildren(ops, rule, parent, c.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t Tracker) createChildren(ops hooks.Operations, rule CreateChildrenRule, parent hooks.CardMsg, checklistID string) error {
+	items, err := ops.FindChecklistItems(checklistID)
+	if err != nil {
+		return errors.Wrap(err, "could not find checklist items")
+	}
+	var dest *destination
+	for i, item := range items {
+		if item.LinkedCardID != "" {
+			continue
+		}
+		if dest == nil {
+			dest, err = resolveDestination(ops, rule)
+			if err != nil {
+				return err
+			}
+		}
+		ok, err := ops.ClaimChecklistItem(item.ID, pendingLink)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// claimed by a concurrent event
+			continue
+		}
+		id, err := createChild(ops, rule, parent, *dest, item.Title, i+1)
+		if err == nil {
+			err = ops.LinkChecklistItem(item.ID, id)
+			if err != nil {
+				removeChild(ops, id)
+			}
+		}
+		if err != nil {
+			// release the item, so the next event creates it
+			if e := ops.LinkChecklistItem(item.ID, ""); e != nil {
+				log.Printf("child.CreateChildren: could not release item %s: %v", item.ID, e)
+			}
+			return err
+		}
+		// cards inserted by the hooks do not fire webhooks
+		err = t.Creation(hooks.ActCreateCard, id, ops)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createFromField creates the children listed in the ItemsField of the
+// parent which it does not have yet, matching them by title.
+func (t Tracker) createFromField(ops hooks.Operations, rule CreateChildrenRule, parent hooks.CardMsg) error {
+	titles, err := fieldItems(ops, rule, parent)
+	if err != nil || len(titles) == 0 {
+		return err
+	}
+	children, err := ops.FindChildren(parent.ID)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not find children of card: %s", parent.ID))
+	}
+	existing := make(map[string]int)
+	for _, c := range children {
+		existing[c.Title]++
+	}
+	var dest *destination
+	for i, title := range titles {
+		if existing[title] > 0 {
+			existing[title]--
+			continue
+		}
+		if dest == nil {
+			dest, err = resolveDestination(ops, rule)
+			if err != nil {
+				return err
+			}
+		}
+		id, err := createChild(ops, rule, parent, *dest, title, i+1)
+		if err != nil {
+			return err
+		}
+		err = t.Creation(hooks.ActCreateCard, id, ops)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldItems returns the non empty lines of the ItemsField of the parent.
+func fieldItems(ops hooks.Operations, rule CreateChildrenRule, parent hooks.CardMsg) ([]string, error) {
+	fieldID, ok, err := ops.FindCustomField(rule.ItemsField, parent.BoardID)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find custom field")
+	}
+	if !ok {
+		// the board of the parent does not use this rule
+		return nil, nil
+	}
+	titles := []string{}
+	for _, cf := range parent.CustomFields {
+		if cf.ID != fieldID {
+			continue
+		}
+		value, err := hooks.CustomFieldString(ops, cf.ID, cf.Value)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("could not read custom field %s", rule.ItemsField))
+		}
+		for _, line := range strings.Split(value, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				titles = append(titles, line)
+			}
+		}
+	}
+	return titles, nil
+}
+
+// createChild creates a child of parent with its custom fields. If a field
+// can not be set, the card is removed.
+func createChild(ops hooks.Operations, rule CreateChildrenRule, parent hooks.CardMsg, dest destination, title string, position int) (string, error) {
+	values, err := childFields(ops, rule, parent, dest.boardID, position)
+	if err != nil {
+		return "", err
+	}
+	log.Println("child.CreateChildren", parent.ID, title)
+	id, err := ops.CreateCard(dest.boardID, dest.listID, dest.swimlaneID, title, parent.ID)
+	if err != nil {
+		return "", errors.Wrap(err, "could not create child card")
+	}
+	for fieldID, value := range values {
+		err = ops.SetCustomField(id, fieldID, value)
+		if err != nil {
+			removeChild(ops, id)
+			return "", errors.Wrap(err, fmt.Sprintf("could not set custom field %s", fieldID))
+		}
+	}
+	return id, nil
+}
+
+// removeChild removes a child whose creation could not be completed. The
+// error that caused it is the one returned, so this one is only logged.
+func removeChild(ops hooks.Operations, cardID string) {
+	err := ops.RemoveCard(cardID)
+	if err != nil {
+		log.Printf("child.CreateChildren: could not remove card %s: %v", cardID, err)
+	}
+}
+
+// destination is where the children are created.
+type destination struct {
+	boardID, listID, swimlaneID string
+}
+
+func resolveDestination(ops hooks.Operations, rule CreateChildrenRule) (*destination, error) {
+	dest := &destination{}
+	boardID, ok, err := ops.FindBoard(rule.Board)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find board")
+	}
+	if !ok {
+		return nil, fmt.Errorf("board not found: %s", rule.Board)
+	}
+	dest.boardID = boardID
+	dest.listID, ok, err = ops.FindList(boardID, rule.List)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find list")
+	}
+	if !ok {
+		return nil, fmt.Errorf("list not found: %s", rule.List)
+	}
+	if rule.Swimlane != "" {
+		dest.swimlaneID, ok, err = ops.FindSwimlane(boardID, rule.Swimlane)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not find swimlane")
+		}
+		if !ok {
+			return nil, fmt.Errorf("swimlane not found: %s", rule.Swimlane)
+		}
+	}
+	return dest, nil
+}
+
+// childFields returns the values of the configured custom fields of the
+// child, by ID in its board, copied from the parent by name since each
+// board has its own fields. Deleted fields of the parent and fields missing
+// in the board of the child are skipped, and so are values that do not fit
+// the type of the field of the child.
+func childFields(ops hooks.Operations, rule CreateChildrenRule, parent hooks.CardMsg, boardID string, position int) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, cf := range parent.CustomFields {
+		if cf.Value == nil {
+			continue
+		}
+		def, ok, err := ops.FindCustomFieldByID(cf.ID)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("could not find custom field: %s", cf.ID))
+		}
+		if !ok {
+			continue
+		}
+		values[def.Name] = def.Format(cf.Value)
+	}
+	if rule.ItemField != "" {
+		values[rule.ItemField] = strconv.Itoa(position)
+	}
+	names := append([]string{}, rule.Fields...)
+	if rule.ItemField != "" {
+		names = append(names, rule.ItemField)
+	}
+	result := make(map[string]string)
+	for _, name := range names {
+		value, ok := values[name]
+		if !ok || value == "" {
+			continue
+		}
+		fieldID, ok, err := ops.FindCustomField(name, boardID)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not find custom field")
+		}
+		if !ok {
+			log.Printf("child.CreateChildren: board %s has no custom field %s", boardID, name)
+			continue
+		}
+		def, ok, err := ops.FindCustomFieldByID(fieldID)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("could not find custom field: %s", fieldID))
+		}
+		if !ok {
+			continue
+		}
+		_, err = def.Parse(value)
+		if err != nil {
+			log.Printf("child.CreateChildren: custom field %s: %v", name, err)
+			continue
+		}
+		result[fieldID] = value
+	}
+	return result, nil
+}
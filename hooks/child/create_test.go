@@ -0,0 +1,183 @@
+package child
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+	"github.com/setecrs/wekan-hooks/hooks/hookstest"
+)
+
+func TestCreateChildren(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddBoard(hooks.Board{ID: "b1", Title: "Registros", Labels: []hooks.Label{{ID: "l1", Name: "criar"}}})
+	ops.AddBoard(hooks.Board{ID: "b2", Title: "Materiais"})
+	entrada := ops.AddList("b2", "Entrada")
+	regIPL := ops.AddCustomField("b1", "ipl")
+	matIPL := ops.AddCustomField("b2", "ipl")
+	matItem := ops.AddCustomField("b2", "item")
+	ops.AddCard(hooks.CardMsg{ID: "parent", Title: "Registro 1", BoardID: "b1"})
+	ops.SetCustomField("parent", regIPL, "123/2019")
+	checklistID, _ := ops.CreateChecklist("parent", "Materiais")
+	ops.AddChecklistItem(checklistID, "Celular", false)
+	ops.AddChecklistItem(checklistID, "Notebook", false)
+	ops.AddChecklistItem(checklistID, "Pendrive", false)
+
+	create := tracker.CreateChildren(CreateChildrenRule{
+		Checklist: "Materiais",
+		Label:     "criar",
+		Board:     "Materiais",
+		List:      "Entrada",
+		Fields:    []string{"ipl"},
+		ItemField: "item",
+	})
+	// a deleted custom field of the parent is skipped
+	ops.Cards["parent"].CustomFields = append(ops.Cards["parent"].CustomFields, hooks.CustomFieldValue{ID: "deleted", Value: "x"})
+	err := create(hooks.ActAddedLabel, "parent", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops.Cards) != 1 {
+		t.Fatalf("expect no children without the label, got %d cards", len(ops.Cards))
+	}
+
+	ops.Cards["parent"].LabelIDs = []string{"l1"}
+	for i := 0; i < 2; i++ {
+		err = create(hooks.ActAddedLabel, "parent", ops)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := make(map[string][2]interface{})
+	for _, c := range ops.Cards {
+		if c.ParentID != "parent" {
+			continue
+		}
+		if c.ListID != entrada {
+			t.Errorf("card %s: expect list %s, got %s", c.Title, entrada, c.ListID)
+		}
+		got[c.Title] = [2]interface{}{ops.Value(c.ID, matIPL), ops.Value(c.ID, matItem)}
+	}
+	expect := map[string][2]interface{}{
+		"Celular":  {"123/2019", "1"},
+		"Notebook": {"123/2019", "2"},
+		"Pendrive": {"123/2019", "3"},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect: %v, got %v", expect, got)
+	}
+	if got := ops.Items("parent", "Celular"); !reflect.DeepEqual(got, map[string]bool{DefaultDone: false}) {
+		t.Errorf("expect parent checklist for the new child, got %v", got)
+	}
+}
+
+func TestCreateChildrenChecklist(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddBoard(hooks.Board{ID: "b1", Title: "Registros", Labels: []hooks.Label{{ID: "l1", Name: "criar"}}})
+	ops.AddBoard(hooks.Board{ID: "b2", Title: "Materiais"})
+	ops.AddList("b2", "Entrada")
+	ops.AddCard(hooks.CardMsg{ID: "parent", Title: "Registro 1", BoardID: "b1"})
+	checklistID, _ := ops.CreateChecklist("parent", "Materiais")
+	ops.AddChecklistItem(checklistID, "Celular", false)
+
+	// the label is an alternative trigger, not a condition
+	create := tracker.CreateChildren(CreateChildrenRule{Checklist: "Materiais", Label: "criar", Board: "Materiais", List: "Entrada"})
+	err := create(hooks.ActAddChecklistItem, "parent", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, _ := ops.FindChildren("parent")
+	if len(children) != 1 || children[0].Title != "Celular" {
+		t.Errorf("expect child Celular, got %v", children)
+	}
+}
+
+func TestCreateChildrenField(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddBoard(hooks.Board{ID: "b1", Title: "Registros"})
+	ops.AddBoard(hooks.Board{ID: "b2", Title: "Materiais"})
+	ops.AddList("b2", "Entrada")
+	itens := ops.AddCustomField("b1", "itens")
+	matItem := ops.AddTypedCustomField("b2", hooks.CustomField{Name: "item", Type: hooks.CustomFieldNumber})
+	ops.AddCard(hooks.CardMsg{ID: "parent", Title: "Registro 1", BoardID: "b1"})
+	ops.SetCustomField("parent", itens, "Celular\nCelular\n\n Notebook ")
+
+	create := tracker.CreateChildren(CreateChildrenRule{ItemsField: "itens", Board: "Materiais", List: "Entrada", ItemField: "item"})
+	for i := 0; i < 2; i++ {
+		err := create(hooks.ActSetCustomField, "parent", ops)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := make(map[string]int)
+	items := make(map[interface{}]bool)
+	children, _ := ops.FindChildren("parent")
+	for _, c := range children {
+		got[c.Title]++
+		items[ops.Value(c.ID, matItem)] = true
+	}
+	if expect := map[string]int{"Celular": 2, "Notebook": 1}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect: %v, got %v", expect, got)
+	}
+	if len(items) != 3 {
+		t.Errorf("expect distinct item numbers, got %v", items)
+	}
+
+	ops.SetCustomField("parent", itens, "Celular\nCelular\nNotebook\nPendrive")
+	err := create(hooks.ActSetCustomField, "parent", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, _ = ops.FindChildren("parent")
+	if len(children) != 4 {
+		t.Errorf("expect 4 children, got %d", len(children))
+	}
+}
+
+// failingFields is a fake whose custom fields can not be set.
+type failingFields struct {
+	*hookstest.Fake
+}
+
+func (f failingFields) SetCustomField(cardID, fieldID, value string) error {
+	return errors.New("write failed")
+}
+
+func TestCreateChildrenFailure(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddBoard(hooks.Board{ID: "b1", Title: "Registros"})
+	ops.AddBoard(hooks.Board{ID: "b2", Title: "Materiais"})
+	ops.AddList("b2", "Entrada")
+	ops.AddCustomField("b2", "item")
+	ops.AddCard(hooks.CardMsg{ID: "parent", Title: "Registro 1", BoardID: "b1"})
+	checklistID, _ := ops.CreateChecklist("parent", "Materiais")
+	celular, _ := ops.AddChecklistItem(checklistID, "Celular", false)
+	notebook, _ := ops.AddChecklistItem(checklistID, "Notebook", false)
+	// claimed by a concurrent event
+	ops.ClaimChecklistItem(notebook, pendingLink)
+
+	create := tracker.CreateChildren(CreateChildrenRule{Checklist: "Materiais", Board: "Materiais", List: "Entrada", ItemField: "item"})
+	err := create(hooks.ActAddChecklistItem, "parent", failingFields{ops})
+	if err == nil {
+		t.Fatal("expect error setting the fields")
+	}
+	if len(ops.Cards) != 1 {
+		t.Errorf("expect the child removed, got %d cards", len(ops.Cards))
+	}
+	if got := ops.ChecklistItems[celular].LinkedCardID; got != "" {
+		t.Errorf("expect item released, got '%s'", got)
+	}
+
+	err = create(hooks.ActAddChecklistItem, "parent", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, _ := ops.FindChildren("parent")
+	if len(children) != 1 || children[0].Title != "Celular" {
+		t.Errorf("expect only child Celular, got %v", children)
+	}
+	if got := ops.ChecklistItems[celular].LinkedCardID; got != children[0].ID {
+		t.Errorf("expect item linked to %s, got '%s'", children[0].ID, got)
+	}
+}
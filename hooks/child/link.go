@@ -0,0 +1,217 @@
+package child
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+)
+
+// CommentAmbiguousParent is the name of the comment posted by LinkParent
+// when more than one card could be the parent. CommentData.Value has the
+// titles of the candidates.
+const CommentAmbiguousParent = "ambiguousParent"
+
+// LinkParentRule finds the parent of a card without one by the value of a
+// custom field of the card.
+type LinkParentRule struct {
+	// Board, if set, is the title of the board of the cards linked.
+	Board string `json:"board"`
+	// Field is the name of the custom field read from the card.
+	Field string `json:"field"`
+	// ParentBoard is the title of the board searched for the parent.
+	ParentBoard string `json:"parentBoard"`
+	// ParentField is the name of the custom field of the parent that must
+	// have the same value. Empty means the title of the parent.
+	ParentField string `json:"parentField"`
+}
+
+// LinkParent returns a hook that sets the parent of a card that has none,
+// when a card is created or a custom field is set. The rules are tried in
+// order, and the first one that finds exactly one card is applied. If a
+// rule finds more than one, nothing is changed and the
+// CommentAmbiguousParent comment, if configured, lists them.
+func (t Tracker) LinkParent(rules []LinkParentRule) hooks.Hooker {
+	reported := newReports(ReportTTL)
+	return func(act string, cardId string, ops hooks.Operations) error {
+		if act != hooks.ActCreateCard && act != hooks.ActSetCustomField {
+			return nil
+		}
+		card, err := ops.FindCard(cardId)
+		if err != nil {
+			return err
+		}
+		if card.ParentID != "" {
+			return nil
+		}
+		for _, rule := range rules {
+			candidates, ok, err := parentCandidates(ops, rule, card)
+			if err != nil {
+				return err
+			}
+			if !ok || len(candidates) == 0 {
+				continue
+			}
+			if len(candidates) > 1 {
+				return reportAmbiguous(ops, reported, card, candidates)
+			}
+			parent := candidates[0]
+			log.Println("child.LinkParent", card.ID, parent.ID)
+			err = ops.SetParent(card.ID, parent.ID)
+			if err != nil {
+				return errors.Wrap(err, "could not set parent")
+			}
+			reported.forget(card.ID)
+			// parent changes do not fire webhooks
+			return t.Creation(hooks.ActCreateCard, card.ID, ops)
+		}
+		return nil
+	}
+}
+
+// parentCandidates returns the cards that match the value of the card for
+// the rule. ok is false if the rule does not apply to the card.
+func parentCandidates(ops hooks.Operations, rule LinkParentRule, card hooks.CardMsg) (candidates []hooks.CardMsg, ok bool, err error) {
+	if rule.Board != "" {
+		board, err := ops.FindBoardByID(card.BoardID)
+		if err != nil {
+			return nil, false, errors.Wrap(err, fmt.Sprintf("could not find board: %s", card.BoardID))
+		}
+		if board.Title != rule.Board {
+			return nil, false, nil
+		}
+	}
+	fieldID, ok, err := ops.FindCustomField(rule.Field, card.BoardID)
+	if err != nil {
+		return nil, false, errors.Wrap(err, fmt.Sprintf("could not find custom field: %s", rule.Field))
+	}
+	if !ok {
+		// the board of the card does not have this field
+		return nil, false, nil
+	}
+	value := ""
+	for _, cf := range card.CustomFields {
+		if cf.ID == fieldID && cf.Value != nil {
+			value, err = hooks.CustomFieldString(ops, fieldID, cf.Value)
+			if err != nil {
+				return nil, false, errors.Wrap(err, fmt.Sprintf("could not find custom field: %s", fieldID))
+			}
+		}
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, false, nil
+	}
+	boardID, ok, err := ops.FindBoard(rule.ParentBoard)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "could not find board")
+	}
+	if !ok {
+		log.Printf("child.LinkParent: parent board not found: %s", rule.ParentBoard)
+		return nil, false, nil
+	}
+	active := false
+	filter := hooks.CardFilter{BoardID: boardID, Archived: &active}
+	if rule.ParentField == "" {
+		filter.Title = "^" + regexp.QuoteMeta(value) + "$"
+	} else {
+		parentFieldID, ok, err := ops.FindCustomField(rule.ParentField, boardID)
+		if err != nil {
+			return nil, false, errors.Wrap(err, fmt.Sprintf("could not find custom field: %s", rule.ParentField))
+		}
+		if !ok {
+			log.Printf("child.LinkParent: board %s has no custom field %s", rule.ParentBoard, rule.ParentField)
+			return nil, false, nil
+		}
+		def, ok, err := ops.FindCustomFieldByID(parentFieldID)
+		if err != nil {
+			return nil, false, errors.Wrap(err, fmt.Sprintf("could not find custom field: %s", parentFieldID))
+		}
+		if !ok {
+			log.Printf("child.LinkParent: custom field not found: %s", parentFieldID)
+			return nil, false, nil
+		}
+		stored, err := def.Parse(value)
+		if err != nil {
+			// the value can not be in the parent field
+			return nil, true, nil
+		}
+		filter.CustomFields = map[string]interface{}{parentFieldID: stored}
+	}
+	cards, err := ops.FindCards(filter)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "could not search parent cards")
+	}
+	candidates = []hooks.CardMsg{}
+	for _, c := range cards {
+		if c.ID != card.ID {
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates, true, nil
+}
+
+func reportAmbiguous(ops hooks.Operations, reported *reports, card hooks.CardMsg, candidates []hooks.CardMsg) error {
+	titles := []string{}
+	for _, c := range candidates {
+		titles = append(titles, c.Title)
+	}
+	value := strings.Join(titles, ", ")
+	if !reported.changed(card.ID, value) {
+		return nil
+	}
+	log.Printf("child.LinkParent: card %s: %d possible parents", card.ID, len(candidates))
+	return hooks.Comment(ops, CommentAmbiguousParent, hooks.CommentData{Card: card, Value: value})
+}
+
+// ReportTTL is how long LinkParent remembers the ambiguity reported for a
+// card. After it, the same comment may be posted again.
+const ReportTTL = 24 * time.Hour
+
+// reports remembers the last ambiguity reported for each card, so the same
+// comment is not posted again on every event.
+type reports struct {
+	sync.Mutex
+	ttl  time.Duration
+	now  func() time.Time
+	last map[string]report
+}
+
+type report struct {
+	value   string
+	expires time.Time
+}
+
+func newReports(ttl time.Duration) *reports {
+	return &reports{ttl: ttl, now: time.Now, last: make(map[string]report)}
+}
+
+// changed reports whether value differs from the last one reported for the
+// card, and records it. Expired entries are dropped.
+func (r *reports) changed(cardID, value string) bool {
+	r.Lock()
+	defer r.Unlock()
+	now := r.now()
+	for id, last := range r.last {
+		if !now.Before(last.expires) {
+			delete(r.last, id)
+		}
+	}
+	if last, ok := r.last[cardID]; ok && last.value == value {
+		return false
+	}
+	r.last[cardID] = report{value: value, expires: now.Add(r.ttl)}
+	return true
+}
+
+func (r *reports) forget(cardID string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.last, cardID)
+}
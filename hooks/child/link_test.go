@@ -0,0 +1,109 @@
+package child
+
+import (
+	"testing"
+	"time"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+	"github.com/setecrs/wekan-hooks/hooks/hookstest"
+)
+
+func TestLinkParent(t *testing.T) {
+	comments, err := hooks.ParseComments(map[string]string{
+		CommentAmbiguousParent: "parent not set, more than one card matches: {{.Value}}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := hookstest.New()
+	ops.Templates = comments
+	ops.AddBoard(hooks.Board{ID: "ipls", Title: "IPLs"})
+	ops.AddBoard(hooks.Board{ID: "registros", Title: "Registros"})
+	ops.AddBoard(hooks.Board{ID: "materiais", Title: "Materiais"})
+	matIPL := ops.AddCustomField("materiais", "ipl")
+	matRegistro := ops.AddCustomField("materiais", "registro")
+	regNumero := ops.AddCustomField("registros", "numero")
+	ops.AddCard(hooks.CardMsg{ID: "ipl1", Title: "123/2019", BoardID: "ipls"})
+	ops.AddCard(hooks.CardMsg{ID: "ipl2", Title: "456/2019", BoardID: "ipls"})
+	ops.AddCard(hooks.CardMsg{ID: "ipl3", Title: "456/2019", BoardID: "ipls"})
+	ops.AddCard(hooks.CardMsg{ID: "reg1", Title: "Registro", BoardID: "registros"})
+	ops.SetCustomField("reg1", regNumero, "R1")
+	ops.AddCard(hooks.CardMsg{ID: "mat1", Title: "Celular", BoardID: "materiais"})
+	ops.AddCard(hooks.CardMsg{ID: "mat2", Title: "Notebook", BoardID: "materiais"})
+	ops.AddCard(hooks.CardMsg{ID: "mat3", Title: "Pendrive", BoardID: "materiais"})
+
+	link := tracker.LinkParent([]LinkParentRule{
+		{Board: "Materiais", Field: "registro", ParentBoard: "Registros", ParentField: "numero"},
+		{Board: "Materiais", Field: "ipl", ParentBoard: "IPLs"},
+	})
+
+	ops.SetCustomField("mat1", matIPL, "123/2019")
+	ops.SetCustomField("mat2", matIPL, "456/2019")
+	ops.SetCustomField("mat3", matIPL, "123/2019")
+	ops.SetCustomField("mat3", matRegistro, "R1")
+	for _, id := range []string{"mat1", "mat2", "mat2", "mat3"} {
+		err := link(hooks.ActSetCustomField, id, ops)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := ops.Cards["mat1"].ParentID; got != "ipl1" {
+		t.Errorf("expect mat1 parent ipl1, got '%s'", got)
+	}
+	if got := ops.Items("ipl1", "Celular"); got == nil {
+		t.Errorf("expect checklist of the child in the parent")
+	}
+	if got := ops.Cards["mat2"].ParentID; got != "" {
+		t.Errorf("expect mat2 without parent, got '%s'", got)
+	}
+	if got := ops.Comments["mat2"]; len(got) != 1 {
+		t.Errorf("expect one comment about the ambiguity, got %q", got)
+	}
+	if got := ops.Cards["mat3"].ParentID; got != "reg1" {
+		t.Errorf("expect mat3 parent reg1, got '%s'", got)
+	}
+}
+
+func TestLinkParentMissingParentBoard(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddBoard(hooks.Board{ID: "materiais", Title: "Materiais"})
+	ops.AddBoard(hooks.Board{ID: "ipls", Title: "IPLs"})
+	matIPL := ops.AddCustomField("materiais", "ipl")
+	ops.AddCard(hooks.CardMsg{ID: "ipl1", Title: "123/2019", BoardID: "ipls"})
+	ops.AddCard(hooks.CardMsg{ID: "mat1", Title: "Celular", BoardID: "materiais"})
+	ops.SetCustomField("mat1", matIPL, "123/2019")
+
+	// misconfigured rules are skipped, the next ones still apply
+	link := tracker.LinkParent([]LinkParentRule{
+		{Field: "ipl", ParentBoard: "Inqueritos"},
+		{Field: "ipl", ParentBoard: "IPLs", ParentField: "numero"},
+		{Field: "ipl", ParentBoard: "IPLs"},
+	})
+	err := link(hooks.ActSetCustomField, "mat1", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ops.Cards["mat1"].ParentID; got != "ipl1" {
+		t.Errorf("expect mat1 parent ipl1, got '%s'", got)
+	}
+}
+
+func TestReportsTTL(t *testing.T) {
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	r := newReports(time.Hour)
+	r.now = func() time.Time { return now }
+	if !r.changed("c1", "a, b") {
+		t.Errorf("expect first report")
+	}
+	if r.changed("c1", "a, b") {
+		t.Errorf("expect same report skipped")
+	}
+	r.changed("c2", "c, d")
+	now = now.Add(time.Hour)
+	if !r.changed("c1", "a, b") {
+		t.Errorf("expect report again after ttl")
+	}
+	if len(r.last) != 1 {
+		t.Errorf("expect expired entries dropped, got %d", len(r.last))
+	}
+}
@@ -0,0 +1,136 @@
+package child
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/pkg/errors"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+)
+
+// MoveParentRule names the list, and optionally the swimlane, where a
+// parent card goes when all its children are done, and where it goes back
+// when one of them is not done anymore. Lists and swimlanes are searched by
+// title in the board of the parent card.
+type MoveParentRule struct {
+	DoneList       string `json:"doneList"`
+	DoneSwimlane   string `json:"doneSwimlane"`
+	UndoneList     string `json:"undoneList"`
+	UndoneSwimlane string `json:"undoneSwimlane"`
+}
+
+// MoveParent returns a hook that applies rule to the parent of the card.
+// Item acts may also refer to the parent itself, so it is checked too. Moves
+// are handled since the items of stages are checked without webhooks, so it
+// must run after the Stages hook.
+func (t Tracker) MoveParent(rule MoveParentRule) hooks.Hooker {
+	return func(act string, cardId string, ops hooks.Operations) error {
+		switch act {
+		case hooks.ActArchivedCard,
+			hooks.ActRestoredCard,
+			hooks.ActMoveCard,
+			hooks.ActCheckedItem,
+			hooks.ActUncheckedItem:
+		default:
+			return nil
+		}
+		card, err := ops.FindCard(cardId)
+		if err != nil {
+			return err
+		}
+		if card.ParentID != "" {
+			err = t.moveParent(ops, rule, card.ParentID)
+			if err != nil {
+				return err
+			}
+		}
+		if act == hooks.ActCheckedItem || act == hooks.ActUncheckedItem {
+			return t.moveParent(ops, rule, card.ID)
+		}
+		return nil
+	}
+}
+
+func (t Tracker) moveParent(ops hooks.Operations, rule MoveParentRule, parentID string) error {
+	parent, err := ops.FindCard(parentID)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not find parent card: %s", parentID))
+	}
+	done, total, err := t.childrenDone(ops, parentID)
+	if err != nil {
+		return err
+	}
+	if total == 0 {
+		return nil
+	}
+	doneListID, ok, err := ops.FindList(parent.BoardID, rule.DoneList)
+	if err != nil {
+		return errors.Wrap(err, "could not find list")
+	}
+	if !ok {
+		// the board of the parent does not use this rule
+		log.Printf("child.MoveParent: board %s has no list %s", parent.BoardID, rule.DoneList)
+		return nil
+	}
+	if done == total {
+		if parent.ListID == doneListID {
+			return nil
+		}
+		log.Println("child.MoveParent: all children done", parent.ID)
+		return moveCard(ops, parent, doneListID, rule.DoneSwimlane)
+	}
+	if parent.ListID != doneListID || rule.UndoneList == "" {
+		return nil
+	}
+	undoneListID, ok, err := ops.FindList(parent.BoardID, rule.UndoneList)
+	if err != nil {
+		return errors.Wrap(err, "could not find list")
+	}
+	if !ok {
+		// the board of the parent does not use this rule
+		log.Printf("child.MoveParent: board %s has no list %s", parent.BoardID, rule.UndoneList)
+		return nil
+	}
+	log.Println("child.MoveParent: child not done anymore", parent.ID)
+	return moveCard(ops, parent, undoneListID, rule.UndoneSwimlane)
+}
+
+func moveCard(ops hooks.Operations, card hooks.CardMsg, listID, swimlane string) error {
+	swimlaneID := ""
+	if swimlane != "" {
+		id, ok, err := ops.FindSwimlane(card.BoardID, swimlane)
+		if err != nil {
+			return errors.Wrap(err, "could not find swimlane")
+		}
+		if !ok {
+			log.Printf("child.MoveParent: board %s has no swimlane %s", card.BoardID, swimlane)
+			return nil
+		}
+		swimlaneID = id
+	}
+	return ops.MoveCard(card.ID, listID, swimlaneID)
+}
+
+// childrenDone counts the children tracked by checklists of the card, and
+// how many of them have the Done item finished.
+func (t Tracker) childrenDone(ops hooks.Operations, cardID string) (done, total int, err error) {
+	checklists, err := ops.FindChecklists(cardID)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "could not find checklists")
+	}
+	for _, c := range checklists {
+		if c.LinkedCardID == "" {
+			continue
+		}
+		total++
+		finished, err := itemFinished(ops, c.ID, t.Done)
+		if err != nil {
+			return 0, 0, err
+		}
+		if finished {
+			done++
+		}
+	}
+	return done, total, nil
+}
@@ -0,0 +1,97 @@
+package child
+
+import (
+	"testing"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+	"github.com/setecrs/wekan-hooks/hooks/hookstest"
+)
+
+func TestMoveParent(t *testing.T) {
+	ops := hookstest.New()
+	todo := ops.AddList("b1", "Em andamento")
+	done := ops.AddList("b1", "Concluido")
+	ops.AddCard(hooks.CardMsg{ID: "parent", Title: "IPL 1", BoardID: "b1", ListID: todo})
+	ops.AddCard(hooks.CardMsg{ID: "c1", Title: "Material 1", ParentID: "parent"})
+	ops.AddCard(hooks.CardMsg{ID: "c2", Title: "Material 2", ParentID: "parent"})
+	moveParent := tracker.MoveParent(MoveParentRule{DoneList: "Concluido", UndoneList: "Em andamento"})
+
+	run := func(act, cardID string) {
+		for _, h := range []hooks.Hooker{tracker.Creation, tracker.Archive, tracker.Restore, moveParent} {
+			err := h(act, cardID, ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	run(hooks.ActCreateCard, "c1")
+	run(hooks.ActCreateCard, "c2")
+	run(hooks.ActArchivedCard, "c1")
+	if got := ops.Cards["parent"].ListID; got != todo {
+		t.Errorf("expect parent to stay in '%s', got '%s'", todo, got)
+	}
+	run(hooks.ActArchivedCard, "c2")
+	if got := ops.Cards["parent"].ListID; got != done {
+		t.Errorf("expect parent moved to '%s', got '%s'", done, got)
+	}
+	run(hooks.ActRestoredCard, "c2")
+	if got := ops.Cards["parent"].ListID; got != todo {
+		t.Errorf("expect parent moved back to '%s', got '%s'", todo, got)
+	}
+}
+
+func TestMoveParentOtherBoard(t *testing.T) {
+	ops := hookstest.New()
+	todo := ops.AddList("b2", "Backlog")
+	ops.AddCard(hooks.CardMsg{ID: "parent", Title: "IPL 1", BoardID: "b2", ListID: todo})
+	ops.AddCard(hooks.CardMsg{ID: "c1", Title: "Material 1", ParentID: "parent"})
+	moveParent := tracker.MoveParent(MoveParentRule{DoneList: "Concluido", UndoneList: "Em andamento", DoneSwimlane: "Fim"})
+
+	for _, act := range []string{hooks.ActCreateCard, hooks.ActArchivedCard, hooks.ActRestoredCard} {
+		for _, h := range []hooks.Hooker{tracker.Creation, tracker.Archive, tracker.Restore, moveParent} {
+			err := h(act, "c1", ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if got := ops.Cards["parent"].ListID; got != todo {
+		t.Errorf("expect parent to stay in '%s', got '%s'", todo, got)
+	}
+}
+
+func TestMoveParentStages(t *testing.T) {
+	ops := hookstest.New()
+	todo := ops.AddList("b1", "Em andamento")
+	done := ops.AddList("b1", "Concluido")
+	entrada := ops.AddList("b2", "Entrada")
+	laudo := ops.AddList("b2", "Laudo")
+	ops.AddCard(hooks.CardMsg{ID: "parent", Title: "IPL 1", BoardID: "b1", ListID: todo})
+	ops.AddCard(hooks.CardMsg{ID: "c1", Title: "Material 1", BoardID: "b2", ListID: entrada, ParentID: "parent"})
+	stages := []Stage{{Item: "Recebido", List: "Entrada"}, {Item: "Laudo", List: "Laudo"}}
+	tracker := NewTracker("", stages)
+	hooksInOrder := []hooks.Hooker{
+		tracker.Creation,
+		Stages(stages),
+		tracker.MoveParent(MoveParentRule{DoneList: "Concluido", UndoneList: "Em andamento"}),
+	}
+	run := func(act string) {
+		for _, h := range hooksInOrder {
+			err := h(act, "c1", ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	run(hooks.ActCreateCard)
+	ops.Cards["c1"].ListID = laudo
+	run(hooks.ActMoveCard)
+	if got := ops.Cards["parent"].ListID; got != done {
+		t.Errorf("expect parent moved to '%s', got '%s'", done, got)
+	}
+	ops.Cards["c1"].ListID = entrada
+	run(hooks.ActMoveCard)
+	if got := ops.Cards["parent"].ListID; got != todo {
+		t.Errorf("expect parent moved back to '%s', got '%s'", todo, got)
+	}
+}
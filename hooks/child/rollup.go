@@ -0,0 +1,175 @@
+package child
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+)
+
+// ProgressField is the custom field of the parent card that receives the
+// number of finished descendants, like "3/7".
+const ProgressField = "progresso"
+
+// Rollup mirrors the checklists of the child card in the parent checklist
+// that tracks it, and updates the progress of every ancestor.
+func (t Tracker) Rollup(act string, cardId string, ops hooks.Operations) error {
+	if act == hooks.ActDeleteCard || cardId == "" {
+		return nil
+	}
+	card, err := ops.FindCard(cardId)
+	if err != nil {
+		return err
+	}
+	if card.ParentID == "" {
+		return nil
+	}
+	checklist, ok, err := findParentChecklist(ops, card)
+	if err != nil {
+		return err
+	}
+	if ok {
+		err = mirrorChecklists(ops, card.ID, checklist.ID)
+		if err != nil {
+			return errors.Wrap(err, "could not mirror checklists")
+		}
+	}
+	return t.updateAncestorsProgress(ops, card.ParentID)
+}
+
+// MirrorPrefix starts the titles of the items that mirror the checklists of
+// the child in the parent checklist, so they are kept apart from the Done
+// and stage items.
+const MirrorPrefix = "Checklist: "
+
+// mirrorChecklists keeps one item in the parent checklist for each checklist
+// of the child, finished when the child checklist is finished, and removes
+// the items of checklists the child no longer has.
+func mirrorChecklists(ops hooks.Operations, childID, parentChecklistID string) error {
+	checklists, err := ops.FindChecklists(childID)
+	if err != nil {
+		return err
+	}
+	mirrored := make(map[string]bool)
+	for _, c := range checklists {
+		if c.LinkedCardID != "" {
+			// tracks a grandchild, not a checklist of the child itself
+			continue
+		}
+		title := MirrorPrefix + c.Title
+		mirrored[title] = true
+		err = setItem(ops, parentChecklistID, title, c.FinishedAt != nil)
+		if err != nil {
+			return err
+		}
+	}
+	items, err := ops.FindChecklistItems(parentChecklistID)
+	if err != nil {
+		return errors.Wrap(err, "could not find checklist items")
+	}
+	for _, item := range items {
+		if !strings.HasPrefix(item.Title, MirrorPrefix) || mirrored[item.Title] {
+			continue
+		}
+		err = ops.RemoveChecklistItem(item.ID)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("could not remove checklist item: %s", item.ID))
+		}
+	}
+	return nil
+}
+
+// updateAncestorsProgress updates the progress field of cardID and of each
+// of its ancestors.
+func (t Tracker) updateAncestorsProgress(ops hooks.Operations, cardID string) error {
+	card, err := ops.FindCard(cardID)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not find card: %s", cardID))
+	}
+	ancestors, err := ops.FindAncestors(cardID)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not find ancestors of card: %s", cardID))
+	}
+	for _, c := range append([]hooks.CardMsg{card}, ancestors...) {
+		err = t.updateProgress(ops, c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t Tracker) updateProgress(ops hooks.Operations, card hooks.CardMsg) error {
+	fieldID, ok, err := ops.FindCustomField(ProgressField, card.BoardID)
+	if err != nil {
+		return errors.Wrap(err, "could not find progress custom field")
+	}
+	if !ok {
+		return nil
+	}
+	done, total, err := t.progress(ops, card.ID)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not compute progress of card %s", card.ID))
+	}
+	value := fmt.Sprintf("%d/%d", done, total)
+	current, _, err := hooks.CardFieldString(ops, card, fieldID)
+	if err != nil || current == value {
+		return err
+	}
+	log.Println("child.Rollup", card.ID, value)
+	return ops.SetCustomField(card.ID, fieldID, value)
+}
+
+// progress counts the descendants without children of a card, and how
+// many of them have the Done item finished in the checklist of their
+// parent.
+func (t Tracker) progress(ops hooks.Operations, cardID string) (done, total int, err error) {
+	descendants, err := ops.FindDescendants(cardID)
+	if err != nil {
+		return 0, 0, err
+	}
+	parents := make(map[string]bool)
+	for _, c := range descendants {
+		parents[c.ParentID] = true
+	}
+	leaves := []string{}
+	for _, c := range descendants {
+		if !parents[c.ID] {
+			leaves = append(leaves, c.ID)
+		}
+	}
+	if len(leaves) == 0 {
+		return 0, 0, nil
+	}
+	checklists, err := ops.FindLinkedChecklists(leaves...)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "could not find linked checklists")
+	}
+	if len(checklists) == 0 {
+		return 0, 0, nil
+	}
+	linked := make(map[string]string)
+	checklistIDs := []string{}
+	for _, c := range checklists {
+		linked[c.ID] = c.LinkedCardID
+		checklistIDs = append(checklistIDs, c.ID)
+	}
+	items, err := ops.FindChecklistItems(checklistIDs...)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "could not find checklist items")
+	}
+	finished := make(map[string]bool)
+	for _, item := range items {
+		if item.Title == t.Done && item.IsFinished {
+			finished[linked[item.ChecklistID]] = true
+		}
+	}
+	tracked := make(map[string]bool)
+	for _, c := range checklists {
+		tracked[c.LinkedCardID] = true
+	}
+	return len(finished), len(tracked), nil
+}
@@ -0,0 +1,90 @@
+package child
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+	"github.com/setecrs/wekan-hooks/hooks/hookstest"
+)
+
+func TestRollup(t *testing.T) {
+	ops := hookstest.New()
+	iplField := ops.AddCustomField("b1", ProgressField)
+	regField := ops.AddCustomField("b2", ProgressField)
+	ops.AddCard(hooks.CardMsg{ID: "ipl", Title: "IPL 1", BoardID: "b1"})
+	ops.AddCard(hooks.CardMsg{ID: "reg1", Title: "Registro 1", BoardID: "b2", ParentID: "ipl"})
+	ops.AddCard(hooks.CardMsg{ID: "reg2", Title: "Registro 2", BoardID: "b2", ParentID: "ipl"})
+	ops.AddCard(hooks.CardMsg{ID: "m1", Title: "Material 1", BoardID: "b3", ParentID: "reg1"})
+	ops.AddCard(hooks.CardMsg{ID: "m2", Title: "Material 2", BoardID: "b3", ParentID: "reg1"})
+
+	run := func(act, cardID string) {
+		for _, h := range []hooks.Hooker{tracker.Creation, tracker.Archive, tracker.Rollup} {
+			err := h(act, cardID, ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, id := range []string{"reg1", "reg2", "m1", "m2"} {
+		run(hooks.ActCreateCard, id)
+	}
+	run(hooks.ActArchivedCard, "m1")
+
+	if got := ops.Value("reg1", regField); got != "1/2" {
+		t.Errorf("registro: expect '1/2', got '%v'", got)
+	}
+	// reg2 has no children, so it counts as one
+	if got := ops.Value("ipl", iplField); got != "1/3" {
+		t.Errorf("ipl: expect '1/3', got '%v'", got)
+	}
+}
+
+func TestRollupMirrorsChecklists(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddCard(hooks.CardMsg{ID: "parent", Title: "IPL 1"})
+	ops.AddCard(hooks.CardMsg{ID: "child", Title: "Material 1", ParentID: "parent"})
+	err := tracker.Creation(hooks.ActCreateCard, "child", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := ops.CreateChecklist("child", "Imagem")
+	now := time.Now()
+	ops.Checklists[id].FinishedAt = &now
+
+	err = tracker.Rollup(hooks.ActCompleteChecklist, "child", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]bool{DefaultDone: false, MirrorPrefix + "Imagem": true}
+	if got := ops.Items("parent", "Material 1"); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect: %v, got %v", expect, got)
+	}
+
+	// a checklist titled like the Done item does not overwrite it
+	id, _ = ops.CreateChecklist("child", DefaultDone)
+	err = tracker.Archive(hooks.ActArchivedCard, "child", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tracker.Rollup(hooks.ActAddChecklist, "child", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = map[string]bool{DefaultDone: true, MirrorPrefix + "Imagem": true, MirrorPrefix + DefaultDone: false}
+	if got := ops.Items("parent", "Material 1"); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect: %v, got %v", expect, got)
+	}
+
+	// the items of removed checklists are removed
+	delete(ops.Checklists, id)
+	err = tracker.Rollup(hooks.ActRemoveChecklist, "child", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = map[string]bool{DefaultDone: true, MirrorPrefix + "Imagem": true}
+	if got := ops.Items("parent", "Material 1"); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect: %v, got %v", expect, got)
+	}
+}
@@ -0,0 +1,98 @@
+package child
+
+import (
+	"log"
+
+	"github.com/pkg/errors"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+)
+
+// Stage is an item of the parent checklist, checked when the child card
+// reaches the list with the given title.
+type Stage struct {
+	Item string `json:"item"`
+	List string `json:"list"`
+}
+
+// Stages returns a hook that keeps one item per stage in the parent
+// checklist. When the child moves to the list of a stage, that stage and
+// the ones before it are checked, and the ones after it are unchecked.
+// Lists that match no stage do not change the items. The items are added
+// on creation by a Tracker with the same stages.
+func Stages(stages []Stage) hooks.Hooker {
+	return func(act string, cardId string, ops hooks.Operations) error {
+		if act != hooks.ActMoveCard {
+			return nil
+		}
+		card, err := ops.FindCard(cardId)
+		if err != nil {
+			return err
+		}
+		if card.ParentID == "" {
+			return nil
+		}
+		checklist, err := parentChecklist(ops, card)
+		if err != nil {
+			return err
+		}
+		return applyStages(ops, stages, card, checklist)
+	}
+}
+
+// applyStages adds the missing items of the stages to the parent checklist
+// of the card, and checks them according to the list of the card.
+func applyStages(ops hooks.Operations, stages []Stage, card hooks.CardMsg, checklist hooks.Checklist) error {
+	current, err := currentStage(ops, stages, card)
+	if err != nil {
+		return err
+	}
+	log.Println("child.Stages", card.ID, current)
+	return checkStages(ops, stages, checklist.ID, current)
+}
+
+// currentStage returns the index of the stage of the list of the card, or
+// -1 if the list matches no stage.
+func currentStage(ops hooks.Operations, stages []Stage, card hooks.CardMsg) (int, error) {
+	list, err := ops.FindListByID(card.ListID)
+	if err != nil {
+		return -1, errors.Wrap(err, "could not find list of card")
+	}
+	current := -1
+	for i, s := range stages {
+		if s.List == list.Title {
+			current = i
+		}
+	}
+	return current, nil
+}
+
+// checkStages adds the missing items of the stages to the checklist, and
+// checks the stages up to current and unchecks the ones after it. A
+// negative current only adds the missing items, unchecked.
+func checkStages(ops hooks.Operations, stages []Stage, checklistID string, current int) error {
+	items, err := ops.FindChecklistItems(checklistID)
+	if err != nil {
+		return errors.Wrap(err, "could not find checklist items")
+	}
+	byTitle := make(map[string]hooks.ChecklistItem)
+	for _, item := range items {
+		byTitle[item.Title] = item
+	}
+	for i, s := range stages {
+		item, ok := byTitle[s.Item]
+		if current < 0 {
+			if !ok {
+				_, err = ops.AddChecklistItem(checklistID, s.Item, false)
+			}
+		} else if !ok {
+			_, err = ops.AddChecklistItem(checklistID, s.Item, i <= current)
+		} else if item.IsFinished != (i <= current) {
+			err = ops.SetChecklistItemFinished(item.ID, i <= current)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package child
+
+import (
+	"reflect"
+	"testing"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+	"github.com/setecrs/wekan-hooks/hooks/hookstest"
+)
+
+func TestStages(t *testing.T) {
+	ops := hookstest.New()
+	entrada := ops.AddList("b2", "Entrada")
+	imagem := ops.AddList("b2", "Imagem")
+	laudo := ops.AddList("b2", "Laudo")
+	outra := ops.AddList("b2", "Outra")
+	ops.AddCard(hooks.CardMsg{ID: "parent", Title: "IPL 1", BoardID: "b1"})
+	ops.AddCard(hooks.CardMsg{ID: "child", Title: "Material 1", BoardID: "b2", ParentID: "parent", ListID: entrada})
+	list := []Stage{
+		{Item: "Recebido", List: "Entrada"},
+		{Item: "Imagem gerada", List: "Imagem"},
+		{Item: "Laudo", List: "Laudo"},
+	}
+	tracker := NewTracker("", list)
+	stages := Stages(list)
+
+	table := []struct {
+		act    string
+		listID string
+		expect map[string]bool
+	}{
+		{hooks.ActCreateCard, entrada, map[string]bool{"Recebido": true, "Imagem gerada": false, "Laudo": false}},
+		{hooks.ActMoveCard, laudo, map[string]bool{"Recebido": true, "Imagem gerada": true, "Laudo": true}},
+		{hooks.ActMoveCard, outra, map[string]bool{"Recebido": true, "Imagem gerada": true, "Laudo": true}},
+		{hooks.ActMoveCard, imagem, map[string]bool{"Recebido": true, "Imagem gerada": true, "Laudo": false}},
+		{hooks.ActArchivedCard, entrada, map[string]bool{"Recebido": true, "Imagem gerada": true, "Laudo": true}},
+		{hooks.ActRestoredCard, entrada, map[string]bool{"Recebido": true, "Imagem gerada": false, "Laudo": false}},
+		{hooks.ActArchivedCard, laudo, map[string]bool{"Recebido": true, "Imagem gerada": true, "Laudo": true}},
+		{hooks.ActRestoredCard, laudo, map[string]bool{"Recebido": true, "Imagem gerada": true, "Laudo": true}},
+		{hooks.ActArchivedCard, outra, map[string]bool{"Recebido": true, "Imagem gerada": true, "Laudo": true}},
+		{hooks.ActRestoredCard, outra, map[string]bool{"Recebido": true, "Imagem gerada": true, "Laudo": false}},
+	}
+	for _, tt := range table {
+		ops.Cards["child"].ListID = tt.listID
+		for _, h := range []hooks.Hooker{tracker.Creation, tracker.Archive, tracker.Restore, stages} {
+			err := h(tt.act, "child", ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := ops.Items("parent", "Material 1"); !reflect.DeepEqual(got, tt.expect) {
+			t.Errorf("%s in list %s: expect: %v, got %v", tt.act, tt.listID, tt.expect, got)
+		}
+	}
+}
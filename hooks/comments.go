@@ -0,0 +1,55 @@
+package hooks
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// CommentData is passed to the comment templates.
+type CommentData struct {
+	// Card is the card that receives the comment.
+	Card CardMsg
+	// Value is the value set by the hook, or the reason the card was
+	// rejected.
+	Value string
+	// Source is the card the value was read from, if any.
+	Source CardMsg
+}
+
+// ParseComments parses the text/template of each comment.
+func ParseComments(templates map[string]string) (map[string]*template.Template, error) {
+	result := make(map[string]*template.Template)
+	for name, text := range templates {
+		t, err := template.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("invalid comment template: %s", name))
+		}
+		result[name] = t
+	}
+	return result, nil
+}
+
+// Comment posts the comment named name to data.Card, if ops has a template
+// for it. Hooks post comments to explain a change they made.
+func Comment(ops Operations, name string, data CommentData) error {
+	t := ops.CommentTemplate(name)
+	if t == nil {
+		return nil
+	}
+	var b bytes.Buffer
+	err := t.Execute(&b, data)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("error executing comment template: %s", name))
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+	_, err = ops.AddComment(data.Card.ID, b.String())
+	if err != nil {
+		return errors.Wrap(err, "could not add comment")
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package hooks
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Types of custom fields.
+const (
+	CustomFieldText     = "text"
+	CustomFieldNumber   = "number"
+	CustomFieldDate     = "date"
+	CustomFieldDropdown = "dropdown"
+	CustomFieldCheckbox = "checkbox"
+	CustomFieldCurrency = "currency"
+)
+
+// DateLayouts are the formats accepted by Parse for date fields.
+var DateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"02/01/2006 15:04",
+	"02/01/2006",
+}
+
+// Parse converts s to the value stored by Wekan for the field: a number for
+// number and currency fields, a date for date fields, a boolean for checkbox
+// fields and the option ID for dropdown fields, where s may be the label or
+// the ID of the option. An empty s is stored as is.
+func (f CustomField) Parse(s string) (interface{}, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	switch f.Type {
+	case CustomFieldNumber, CustomFieldCurrency:
+		n, err := strconv.ParseFloat(plainNumber(s), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number for field %s: '%s'", f.Name, s)
+		}
+		return n, nil
+	case CustomFieldDate:
+		for _, layout := range DateLayouts {
+			t, err := time.ParseInLocation(layout, s, time.Local)
+			if err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid date for field %s: '%s'", f.Name, s)
+	case CustomFieldCheckbox:
+		switch strings.ToLower(s) {
+		case "sim", "s":
+			return true, nil
+		case "nao", "não", "n":
+			return false, nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid checkbox value for field %s: '%s'", f.Name, s)
+		}
+		return b, nil
+	case CustomFieldDropdown:
+		for _, item := range f.Settings.DropdownItems {
+			if item.Name == s || item.ID == s {
+				return item.ID, nil
+			}
+		}
+		return nil, fmt.Errorf("option not found in field %s: '%s'", f.Name, s)
+	}
+	return s, nil
+}
+
+// Format converts a value stored by Wekan to the text shown to the user,
+// which Parse accepts back.
+func (f CustomField) Format(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case primitive.DateTime:
+		return formatDate(time.Unix(0, int64(v)*int64(time.Millisecond)))
+	case time.Time:
+		return formatDate(v)
+	case string:
+		if f.Type == CustomFieldDropdown {
+			for _, item := range f.Settings.DropdownItems {
+				if item.ID == v {
+					return item.Name
+				}
+			}
+		}
+		return v
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func formatDate(t time.Time) string {
+	t = t.In(time.Local)
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02T15:04")
+}
+
+// plainNumber converts a number written with thousands separators, like
+// "1.234,56" or "1,234.56", to a plain decimal. When both separators are
+// used, the last one is the decimal separator. A single separator is the
+// decimal separator, unless it is repeated, like in "1.234.567". A comma
+// alone is read as the decimal separator, so "1,234" is 1.234.
+func plainNumber(s string) string {
+	dot, comma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	switch {
+	case dot >= 0 && comma >= 0:
+		if comma > dot {
+			s = strings.Replace(s, ".", "", -1)
+			return strings.Replace(s, ",", ".", 1)
+		}
+		return strings.Replace(s, ",", "", -1)
+	case comma >= 0:
+		if strings.Count(s, ",") > 1 {
+			return strings.Replace(s, ",", "", -1)
+		}
+		return strings.Replace(s, ",", ".", 1)
+	case dot >= 0 && strings.Count(s, ".") > 1:
+		return strings.Replace(s, ".", "", -1)
+	}
+	return s
+}
+
+// CustomFieldString returns the text shown to the user for the value of a
+// custom field.
+func CustomFieldString(ops Operations, fieldID string, value interface{}) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	def, ok, err := ops.FindCustomFieldByID(fieldID)
+	if err != nil || !ok {
+		// a value of a deleted custom field is not shown
+		return "", err
+	}
+	return def.Format(value), nil
+}
+
+// CardFieldString returns the text shown to the user for the value of a
+// custom field of the card, and whether it is not empty. Values are compared
+// and copied as text, since each board has its own field definitions and
+// dropdown options.
+func CardFieldString(ops Operations, card CardMsg, fieldID string) (string, bool, error) {
+	for _, cf := range card.CustomFields {
+		if cf.ID == fieldID && cf.Value != nil {
+			s, err := CustomFieldString(ops, fieldID, cf.Value)
+			if err != nil {
+				return "", false, errors.Wrap(err, fmt.Sprintf("could not find custom field: %s", fieldID))
+			}
+			return s, s != "", nil
+		}
+	}
+	return "", false, nil
+}
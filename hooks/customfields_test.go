@@ -0,0 +1,81 @@
+package hooks
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseFormat(t *testing.T) {
+	dropdown := CustomField{Name: "tipo", Type: CustomFieldDropdown, Settings: CustomFieldSettings{
+		DropdownItems: []DropdownItem{{ID: "a1", Name: "Celular"}, {ID: "a2", Name: "Notebook"}},
+	}}
+	date := time.Date(2019, 7, 1, 0, 0, 0, 0, time.Local)
+	table := []struct {
+		field  CustomField
+		input  string
+		expect interface{}
+		format string
+	}{
+		{CustomField{Type: CustomFieldText}, " abc ", "abc", "abc"},
+		{CustomField{Type: ""}, "abc", "abc", "abc"},
+		{CustomField{Type: CustomFieldNumber}, "12", 12.0, "12"},
+		{CustomField{Type: CustomFieldNumber}, "1,5", 1.5, "1.5"},
+		{CustomField{Type: CustomFieldCurrency}, "10.25", 10.25, "10.25"},
+		{CustomField{Type: CustomFieldCurrency}, "1.234,56", 1234.56, "1234.56"},
+		{CustomField{Type: CustomFieldCurrency}, "1,234.56", 1234.56, "1234.56"},
+		{CustomField{Type: CustomFieldNumber}, "1.234.567", 1234567.0, "1234567"},
+		{CustomField{Type: CustomFieldDate}, "2019-07-01", date, "2019-07-01"},
+		{CustomField{Type: CustomFieldDate}, "01/07/2019", date, "2019-07-01"},
+		{CustomField{Type: CustomFieldCheckbox}, "true", true, "true"},
+		{CustomField{Type: CustomFieldCheckbox}, "não", false, "false"},
+		{dropdown, "Notebook", "a2", "Notebook"},
+		{dropdown, "a1", "a1", "Celular"},
+		{CustomField{Type: CustomFieldNumber}, "", "", ""},
+	}
+	for _, tt := range table {
+		got, err := tt.field.Parse(tt.input)
+		if err != nil {
+			t.Errorf("%s '%s': unexpected error: %v", tt.field.Type, tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expect) {
+			t.Errorf("%s '%s': expect %#v, got %#v", tt.field.Type, tt.input, tt.expect, got)
+		}
+		if s := tt.field.Format(got); s != tt.format {
+			t.Errorf("%s '%s': expect format '%s', got '%s'", tt.field.Type, tt.input, tt.format, s)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	dropdown := CustomField{Type: CustomFieldDropdown, Settings: CustomFieldSettings{
+		DropdownItems: []DropdownItem{{ID: "a1", Name: "Celular"}},
+	}}
+	table := []struct {
+		field CustomField
+		input string
+	}{
+		{CustomField{Type: CustomFieldNumber}, "abc"},
+		{CustomField{Type: CustomFieldNumber}, "1,2.3,4"},
+		{CustomField{Type: CustomFieldDate}, "julho"},
+		{CustomField{Type: CustomFieldCheckbox}, "talvez"},
+		{dropdown, "Tablet"},
+	}
+	for _, tt := range table {
+		_, err := tt.field.Parse(tt.input)
+		if err == nil {
+			t.Errorf("%s '%s': expect error", tt.field.Type, tt.input)
+		}
+	}
+}
+
+func TestFormatDateTime(t *testing.T) {
+	date := time.Date(2019, 7, 1, 0, 0, 0, 0, time.Local)
+	v := primitive.DateTime(date.UnixNano() / int64(time.Millisecond))
+	if got := (CustomField{Type: CustomFieldDate}).Format(v); got != "2019-07-01" {
+		t.Errorf("expect '2019-07-01', got '%s'", got)
+	}
+}
@@ -13,6 +13,7 @@ import (
 )
 
 type CustomFieldsIDs struct {
+	board       string
 	ipl         string
 	registro    string
 	solicitacao string
@@ -22,121 +23,301 @@ type CustomFieldsIDs struct {
 	path        string
 }
 
-var BoardMateriaisID string
-var customFieldsIDs CustomFieldsIDs
+// SolicitacaoPattern is the official format of request numbers:
+// number/year.
+var SolicitacaoPattern = regexp.MustCompile(`^(\d+)/(\d{4})$`)
 
-func IPL(act string, cardId string, ops hooks.Operations) error {
+// Values of PathCollision.
+const (
+	// CollisionFlag keeps the path and reports the collision in the erro
+	// field of every card involved.
+	CollisionFlag = "flag"
+	// CollisionSuffix adds a numeric suffix to the new path.
+	CollisionSuffix = "suffix"
+)
+
+// Names of the comments posted by the hooks of this package, if configured
+// in hooks.Comments.
+const (
+	// CommentIPL is posted when ipl is filled from the grandparent.
+	CommentIPL = "ipl"
+	// CommentPath is posted when a path is generated.
+	CommentPath = "path"
+	// CommentErro is posted when a card is rejected.
+	CommentErro = "erro"
+)
+
+// Materiais has the hooks of the boards of materials, which have the ipl,
+// registro, solicitacao, auto, item, erro and path custom fields. The IDs
+// of the custom fields are cached, so each Wekan database needs its own.
+type Materiais struct {
+	// PathCollision is what Path does when the path it generates is
+	// already used by another card.
+	PathCollision string
+	ids           *resolver
+}
+
+// NewMateriais returns the hooks of the boards of materials, given by title
+// or ID. Cards of other boards are ignored. An empty pathCollision means
+// CollisionFlag.
+func NewMateriais(boards []string, pathCollision string) *Materiais {
+	if pathCollision == "" {
+		pathCollision = CollisionFlag
+	}
+	return &Materiais{PathCollision: pathCollision, ids: newResolver(boards, ResolverTTL)}
+}
+
+func (m *Materiais) IPL(act string, cardId string, ops hooks.Operations) error {
 	if act != hooks.ActMoveCard {
 		return nil
 	}
-	err := checkIDs(ops)
-	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("IPL: error checking IDs of custom fields"))
-	}
 	card, err := ops.FindCard(cardId)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("could not find card: %s", cardId))
 	}
-	if card.BoardID != BoardMateriaisID {
+	ids, ok, err := m.ids.get(ops, card.BoardID)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("IPL: error checking IDs of custom fields"))
+	}
+	if !ok {
 		return nil
 	}
-	for _, cf := range card.CustomFields {
-		if cf.ID == customFieldsIDs.ipl {
-			if cf.Value != nil {
-				if fmt.Sprintf("%v", cf.Value) != "" {
-					// ipl already filled
-					return nil
-				}
-			}
-		}
+	_, filled, err := hooks.CardFieldString(ops, card, ids.ipl)
+	if err != nil {
+		return err
 	}
-	if card.ParentID == "" {
-		// Material has no parent
+	if filled {
 		return nil
 	}
-	reg, err := ops.FindCard(card.ParentID)
+	ancestors, err := ops.FindAncestors(cardId)
 	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("could not find parent card: %s", card.ParentID))
+		return errors.Wrap(err, fmt.Sprintf("could not find ancestors of card: %s", cardId))
 	}
-	if reg.ParentID == "" {
+	if len(ancestors) < 2 {
 		// Material has no grand parent
 		return nil
 	}
-	ipl, err := ops.FindCard(reg.ParentID)
-	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("could not find parent card: %s", card.ParentID))
-	}
-	err = ops.SetCustomField(cardId, customFieldsIDs.ipl, ipl.Title)
+	ipl := ancestors[1]
+	err = m.setField(ops, ids, cardId, ids.ipl, ipl.Title)
 	if err != nil {
 		return errors.Wrap(err, "could not update custom field ipl")
 	}
-	return nil
+	return hooks.Comment(ops, CommentIPL, hooks.CommentData{Card: card, Value: ipl.Title, Source: ipl})
 }
 
-func Path(act string, cardId string, ops hooks.Operations) error {
+func (m *Materiais) Path(act string, cardId string, ops hooks.Operations) error {
 	if act != hooks.ActMoveCard {
 		return nil
 	}
-	err := checkIDs(ops)
+	card, err := ops.FindCard(cardId)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not find card: %s", cardId))
+	}
+	ids, ok, err := m.ids.get(ops, card.BoardID)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("Path: error checking IDs of custom fields"))
 	}
-	card, err := ops.FindCard(cardId)
+	if !ok {
+		return nil
+	}
+	path, filled, err := hooks.CardFieldString(ops, card, ids.path)
 	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("could not find card: %s", cardId))
+		return err
+	}
+	if !filled {
+		values, err := pathValues(ops, ids, card)
+		if err != nil {
+			return err
+		}
+		path, err = buildPath(card, values, ids)
+		if err != nil {
+			log.Printf("Path: card %s: %v", cardId, err)
+			return m.setErro(ops, ids, card, err.Error())
+		}
+	}
+	others, err := samePath(ops, ids, card, path)
+	if err != nil {
+		return err
+	}
+	if len(others) > 0 && !filled && m.PathCollision == CollisionSuffix {
+		path, err = uniquePath(ops, ids, card, path)
+		if err != nil {
+			return err
+		}
+		others = nil
+	}
+	if !filled {
+		err = m.setField(ops, ids, cardId, ids.path, path)
+		if err != nil {
+			return errors.Wrap(err, "could not update custom field path")
+		}
+		err = hooks.Comment(ops, CommentPath, hooks.CommentData{Card: card, Value: path})
+		if err != nil {
+			return err
+		}
+	}
+	if len(others) == 0 {
+		return m.setErro(ops, ids, card, "")
+	}
+	titles := []string{}
+	for _, other := range others {
+		titles = append(titles, other.Title)
+		err = m.setErro(ops, ids, other, fmt.Sprintf("path also used by card: %s", card.Title))
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Path: card %s: path %s also used by %d cards", cardId, path, len(others))
+	return m.setErro(ops, ids, card, fmt.Sprintf("path also used by card: %s", strings.Join(titles, ", ")))
+}
+
+// samePath returns the other cards in the board with the given path.
+func samePath(ops hooks.Operations, ids CustomFieldsIDs, card hooks.CardMsg, path string) ([]hooks.CardMsg, error) {
+	def, ok, err := ops.FindCustomFieldByID(ids.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find custom field path")
+	}
+	if !ok {
+		return nil, fmt.Errorf("custom field not found: %s", ids.path)
 	}
-	if card.BoardID != BoardMateriaisID {
+	stored, err := def.Parse(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid path")
+	}
+	cards, err := ops.FindCards(hooks.CardFilter{
+		BoardID:      card.BoardID,
+		CustomFields: map[string]interface{}{ids.path: stored},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not search cards by path")
+	}
+	others := []hooks.CardMsg{}
+	for _, c := range cards {
+		if c.ID != card.ID {
+			others = append(others, c)
+		}
+	}
+	return others, nil
+}
+
+// uniquePath adds a numeric suffix to the file name of path, so it is not
+// used by any other card.
+func uniquePath(ops hooks.Operations, ids CustomFieldsIDs, card hooks.CardMsg, path string) (string, error) {
+	base := strings.TrimSuffix(path, ".dd")
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s_%d.dd", base, i)
+		others, err := samePath(ops, ids, card, candidate)
+		if err != nil {
+			return "", err
+		}
+		if len(others) == 0 {
+			return candidate, nil
+		}
+	}
+}
+
+// setErro shows msg in the erro custom field of the card, so the validation
+// failure is visible in Wekan. An empty msg clears the field.
+func (m *Materiais) setErro(ops hooks.Operations, ids CustomFieldsIDs, card hooks.CardMsg, msg string) error {
+	current, _, err := hooks.CardFieldString(ops, card, ids.erro)
+	if err != nil {
+		return err
+	}
+	if current == msg {
 		return nil
 	}
-	for _, cf := range card.CustomFields {
-		if cf.ID == customFieldsIDs.path {
-			if cf.Value != nil {
-				if fmt.Sprintf("%v", cf.Value) != "" {
-					// path already filled
-					return nil
-				}
+	err = m.setField(ops, ids, card.ID, ids.erro, msg)
+	if err != nil {
+		return errors.Wrap(err, "could not update custom field erro")
+	}
+	if msg == "" {
+		return nil
+	}
+	return hooks.Comment(ops, CommentErro, hooks.CommentData{Card: card, Value: msg})
+}
+
+// setField sets a custom field of the card. A field deleted or removed from
+// the board after its ID was cached is not written, since the write would
+// add an entry no field shows, and the cached IDs are dropped so the next
+// event resolves them again.
+func (m *Materiais) setField(ops hooks.Operations, ids CustomFieldsIDs, cardID, fieldID, value string) error {
+	def, ok, err := ops.FindCustomFieldByID(fieldID)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not find custom field: %s", fieldID))
+	}
+	if ok {
+		ok = false
+		for _, id := range def.BoardIDs {
+			if id == ids.board {
+				ok = true
 			}
 		}
 	}
-	path, err := buildPath(card)
+	if !ok {
+		m.ids.invalidate()
+		return fmt.Errorf("custom field %s is not in board %s anymore", fieldID, ids.board)
+	}
+	v, err := def.Parse(value)
 	if err != nil {
-		return errors.Wrap(err, "could not buildPath")
+		return err
 	}
-	err = ops.SetCustomField(cardId, customFieldsIDs.path, path)
+	err = ops.SetCustomFieldValue(cardID, fieldID, v)
 	if err != nil {
-		return errors.Wrap(err, "could not update custom field path")
+		m.ids.invalidate()
+		return err
 	}
 	return nil
 }
 
-func buildPath(card hooks.CardMsg) (string, error) {
+// pathValues returns the values of the custom fields used in the path, as
+// shown to the user, without the empty ones.
+func pathValues(ops hooks.Operations, ids CustomFieldsIDs, card hooks.CardMsg) (map[string]string, error) {
 	idValue := make(map[string]string)
-	for _, cf := range card.CustomFields {
-		if cf.Value == nil {
-			continue
+	for _, id := range []string{ids.ipl, ids.registro, ids.solicitacao, ids.auto, ids.item} {
+		s, ok, err := hooks.CardFieldString(ops, card, id)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			idValue[id] = s
 		}
-		idValue[cf.ID] = fmt.Sprintf("%v", cf.Value)
 	}
+	return idValue, nil
+}
+
+// buildPath builds the path of the card from the values of its custom
+// fields, by ID.
+func buildPath(card hooks.CardMsg, idValue map[string]string, ids CustomFieldsIDs) (string, error) {
 	var b bytes.Buffer
 	b.WriteString("/operacoes/")
-	if s, ok := idValue[customFieldsIDs.ipl]; ok {
+	if s, ok := idValue[ids.ipl]; ok {
 		s = normalizeString(s)
 		b.WriteString(s)
 		b.WriteString("/")
-	} else if s, ok := idValue[customFieldsIDs.registro]; ok {
+	} else if s, ok := idValue[ids.registro]; ok {
 		s = normalizeString(s)
 		b.WriteString(s)
 		b.WriteString("/")
+	} else if s, ok := idValue[ids.solicitacao]; ok {
+		m := SolicitacaoPattern.FindStringSubmatch(strings.TrimSpace(s))
+		if m == nil {
+			return "", fmt.Errorf("solicitacao '%s' does not match number/year", s)
+		}
+		b.WriteString("solicitacao_")
+		b.WriteString(m[1])
+		b.WriteString("_")
+		b.WriteString(m[2])
+		b.WriteString("/")
 	} else {
-		return "", fmt.Errorf("card %s does not have ipl or registro in custom fields", card.ID)
+		return "", fmt.Errorf("card does not have ipl, registro or solicitacao in custom fields")
 	}
-	if s, ok := idValue[customFieldsIDs.auto]; ok {
+	if s, ok := idValue[ids.auto]; ok {
 		s = normalizeString(s)
 		b.WriteString("auto_apreensao_")
 		b.WriteString(s)
 		b.WriteString("/")
 	}
-	if s, ok := idValue[customFieldsIDs.item]; ok {
+	if s, ok := idValue[ids.item]; ok {
 		s = normalizeString(s)
 		b.WriteString("item")
 		b.WriteString(s)
@@ -162,71 +343,44 @@ func normalizeString(s string) string {
 	return s
 }
 
-func checkIDs(ops hooks.Operations) error {
-	if BoardMateriaisID == "" {
-		id, ok, err := ops.FindBoard("Materiais")
-		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("checkIDs: error searching board"))
-		}
-		if !ok {
-			return fmt.Errorf("Board Materiais not found.")
-		}
-		BoardMateriaisID = id
-	}
-	if customFieldsIDs.ipl == "" {
-		id, err := getID(ops, "ipl")
-		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("checkIDs: error getting ID"))
-		}
-		customFieldsIDs.ipl = id
-	}
-	if customFieldsIDs.registro == "" {
-		id, err := getID(ops, "registro")
-		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("checkIDs: error getting ID"))
-		}
-		customFieldsIDs.registro = id
-	}
-	if customFieldsIDs.solicitacao == "" {
-		id, err := getID(ops, "solicitacao")
-		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("checkIDs: error getting ID"))
-		}
-		customFieldsIDs.solicitacao = id
-	}
-	if customFieldsIDs.auto == "" {
-		id, err := getID(ops, "auto")
-		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("checkIDs: error getting ID"))
-		}
-		customFieldsIDs.auto = id
-	}
-	if customFieldsIDs.item == "" {
-		id, err := getID(ops, "item")
-		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("checkIDs: error getting ID"))
-		}
-		customFieldsIDs.item = id
+// resolveIDs searches the custom fields of the board. ok is false if the
+// board is not one of boards, given by title or ID.
+func resolveIDs(ops hooks.Operations, boards []string, boardID string) (ids CustomFieldsIDs, ok bool, err error) {
+	board, err := ops.FindBoardByID(boardID)
+	if err != nil {
+		return ids, false, errors.Wrap(err, fmt.Sprintf("resolveIDs: error searching board"))
 	}
-	if customFieldsIDs.erro == "" {
-		id, err := getID(ops, "erro")
-		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("checkIDs: error getting ID"))
+	for _, b := range boards {
+		if b == board.ID || b == board.Title {
+			ok = true
 		}
-		customFieldsIDs.erro = id
 	}
-	if customFieldsIDs.path == "" {
-		id, err := getID(ops, "path")
+	if !ok {
+		return ids, false, nil
+	}
+	ids.board = board.ID
+	for _, f := range []struct {
+		title string
+		id    *string
+	}{
+		{"ipl", &ids.ipl},
+		{"registro", &ids.registro},
+		{"solicitacao", &ids.solicitacao},
+		{"auto", &ids.auto},
+		{"item", &ids.item},
+		{"erro", &ids.erro},
+		{"path", &ids.path},
+	} {
+		*f.id, err = getID(ops, ids.board, f.title)
 		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("checkIDs: error getting ID"))
+			return CustomFieldsIDs{}, false, errors.Wrap(err, fmt.Sprintf("resolveIDs: error getting ID"))
 		}
-		customFieldsIDs.path = id
 	}
-	return nil
+	return ids, true, nil
 }
 
-func getID(ops hooks.Operations, title string) (string, error) {
-	id, ok, err := ops.FindCustomField(title, BoardMateriaisID)
+func getID(ops hooks.Operations, boardID, title string) (string, error) {
+	id, ok, err := ops.FindCustomField(title, boardID)
 	if err != nil {
 		return "", errors.Wrap(err, fmt.Sprintf("getID: error searching for '%s'", title))
 	}
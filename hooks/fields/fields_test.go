@@ -1,6 +1,12 @@
 package fields
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+	"github.com/setecrs/wekan-hooks/hooks/hookstest"
+)
 
 func TestNormalizeString(t *testing.T) {
 	table := []struct {
@@ -23,3 +29,208 @@ func TestNormalizeString(t *testing.T) {
 		}
 	}
 }
+
+// newMateriais returns a fake with the Materiais board and its custom
+// fields.
+func newMateriais() (*hookstest.Fake, map[string]string) {
+	ops := hookstest.New()
+	ops.AddBoard(hooks.Board{ID: "materiais", Title: "Materiais"})
+	ids := make(map[string]string)
+	for _, name := range []string{"ipl", "registro", "solicitacao", "auto", "item", "erro", "path"} {
+		ids[name] = ops.AddCustomField("materiais", name)
+	}
+	return ops, ids
+}
+
+func TestPathErro(t *testing.T) {
+	ops, ids := newMateriais()
+	m := NewMateriais([]string{"Materiais"}, "")
+	ops.AddCard(hooks.CardMsg{ID: "mat", Title: "Celular", BoardID: "materiais"})
+
+	err := m.Path(hooks.ActMoveCard, "mat", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ops.Value("mat", ids["erro"]); got == nil || got == "" {
+		t.Errorf("expect erro to be filled")
+	}
+	if got := ops.Value("mat", ids["path"]); got != nil {
+		t.Errorf("expect no path, got '%v'", got)
+	}
+
+	ops.SetCustomField("mat", ids["registro"], "R1")
+	err = m.Path(hooks.ActMoveCard, "mat", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ops.Value("mat", ids["erro"]); got != "" {
+		t.Errorf("expect erro to be cleared, got '%v'", got)
+	}
+	if got := ops.Value("mat", ids["path"]); got != "/operacoes/R1/Celular.dd" {
+		t.Errorf("expect path '/operacoes/R1/Celular.dd', got '%v'", got)
+	}
+}
+
+func TestBuildPathSolicitacao(t *testing.T) {
+	ids := CustomFieldsIDs{ipl: "ipl", registro: "registro", solicitacao: "solicitacao", item: "item"}
+	table := []struct {
+		values map[string]string
+		expect string
+		err    bool
+	}{
+		{map[string]string{"solicitacao": "123/2019"}, "/operacoes/solicitacao_123_2019/Celular.dd", false},
+		{map[string]string{"solicitacao": " 45/2019 ", "item": "2"}, "/operacoes/solicitacao_45_2019/item2_Celular/item2_Celular.dd", false},
+		{map[string]string{"solicitacao": "123/2019", "registro": "R1"}, "/operacoes/R1/Celular.dd", false},
+		{map[string]string{"solicitacao": "123/2019", "ipl": ""}, "/operacoes/solicitacao_123_2019/Celular.dd", false},
+		{map[string]string{"solicitacao": "123-2019"}, "", true},
+		{map[string]string{"solicitacao": "123/19"}, "", true},
+		{map[string]string{}, "", true},
+	}
+	for _, tt := range table {
+		card := hooks.CardMsg{ID: "mat", Title: "Celular"}
+		values := make(map[string]string)
+		for id, v := range tt.values {
+			if v != "" {
+				values[id] = v
+			}
+		}
+		got, err := buildPath(card, values, ids)
+		if (err != nil) != tt.err {
+			t.Errorf("%v: expect error %v, got %v", tt.values, tt.err, err)
+		}
+		if got != tt.expect {
+			t.Errorf("%v: expect: '%s', got '%s'", tt.values, tt.expect, got)
+		}
+	}
+}
+
+func TestPathCollision(t *testing.T) {
+	for _, mode := range []string{CollisionFlag, CollisionSuffix} {
+		m := NewMateriais([]string{"Materiais"}, mode)
+		ops, ids := newMateriais()
+		for _, id := range []string{"mat1", "mat2"} {
+			ops.AddCard(hooks.CardMsg{ID: id, Title: "Celular", BoardID: "materiais"})
+			ops.SetCustomField(id, ids["registro"], "R1")
+			err := m.Path(hooks.ActMoveCard, id, ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		path1 := ops.Value("mat1", ids["path"])
+		path2 := ops.Value("mat2", ids["path"])
+		erro1 := ops.Value("mat1", ids["erro"])
+		erro2 := ops.Value("mat2", ids["erro"])
+		switch mode {
+		case CollisionFlag:
+			if path1 != path2 {
+				t.Errorf("flag: expect same paths, got '%v' and '%v'", path1, path2)
+			}
+			if erro1 == "" || erro1 == nil || erro2 == "" || erro2 == nil {
+				t.Errorf("flag: expect both cards flagged, got '%v' and '%v'", erro1, erro2)
+			}
+		case CollisionSuffix:
+			if path2 != "/operacoes/R1/Celular_2.dd" {
+				t.Errorf("suffix: expect '/operacoes/R1/Celular_2.dd', got '%v'", path2)
+			}
+			if (erro1 != "" && erro1 != nil) || (erro2 != "" && erro2 != nil) {
+				t.Errorf("suffix: expect no cards flagged, got '%v' and '%v'", erro1, erro2)
+			}
+		}
+	}
+}
+
+func TestPathComments(t *testing.T) {
+	comments, err := hooks.ParseComments(map[string]string{
+		CommentPath: "path: {{.Value}}",
+		CommentErro: "{{.Card.Title}} rejected: {{.Value}}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops, ids := newMateriais()
+	ops.Templates = comments
+	m := NewMateriais([]string{"Materiais"}, "")
+	ops.AddCard(hooks.CardMsg{ID: "mat", Title: "Celular", BoardID: "materiais"})
+	err = m.Path(hooks.ActMoveCard, "mat", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ops.Comments["mat"]; len(got) != 1 || !strings.HasPrefix(got[0], "Celular rejected: ") {
+		t.Errorf("unexpected comments: %q", got)
+	}
+
+	ops.SetCustomField("mat", ids["registro"], "R1")
+	err = m.Path(hooks.ActMoveCard, "mat", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ops.Comments["mat"]; len(got) != 2 || got[1] != "path: /operacoes/R1/Celular.dd" {
+		t.Errorf("unexpected comments: %q", got)
+	}
+
+	// clearing erro or keeping the path posts nothing
+	err = m.Path(hooks.ActMoveCard, "mat", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ops.Comments["mat"]; len(got) != 2 {
+		t.Errorf("unexpected comments: %q", got)
+	}
+}
+
+func TestIPL(t *testing.T) {
+	ops, ids := newMateriais()
+	m := NewMateriais([]string{"Materiais"}, "")
+	ops.AddCard(hooks.CardMsg{ID: "ipl", Title: "IPL 123/2019", BoardID: "ipls"})
+	ops.AddCard(hooks.CardMsg{ID: "reg", Title: "Registro", BoardID: "registros", ParentID: "ipl"})
+	ops.AddCard(hooks.CardMsg{ID: "mat", Title: "Celular", BoardID: "materiais", ParentID: "reg"})
+	ops.AddCard(hooks.CardMsg{ID: "orphan", Title: "Notebook", BoardID: "materiais", ParentID: "reg2"})
+
+	for _, id := range []string{"mat", "orphan"} {
+		err := m.IPL(hooks.ActMoveCard, id, ops)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := ops.Value("mat", ids["ipl"]); got != "IPL 123/2019" {
+		t.Errorf("expect ipl 'IPL 123/2019', got '%v'", got)
+	}
+	if got := ops.Value("orphan", ids["ipl"]); got != nil {
+		t.Errorf("expect no ipl, got '%v'", got)
+	}
+}
+
+func TestPathTypedFields(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddBoard(hooks.Board{ID: "materiais", Title: "Materiais"})
+	ids := make(map[string]string)
+	for _, name := range []string{"ipl", "registro", "solicitacao", "erro", "path"} {
+		ids[name] = ops.AddCustomField("materiais", name)
+	}
+	ids["auto"] = ops.AddTypedCustomField("materiais", hooks.CustomField{
+		Name: "auto", Type: hooks.CustomFieldDropdown, Settings: hooks.CustomFieldSettings{
+			DropdownItems: []hooks.DropdownItem{{ID: "opt1", Name: "55"}},
+		},
+	})
+	ids["item"] = ops.AddTypedCustomField("materiais", hooks.CustomField{Name: "item", Type: hooks.CustomFieldNumber})
+	m := NewMateriais([]string{"Materiais"}, "")
+	ops.AddCard(hooks.CardMsg{ID: "mat", Title: "Celular", BoardID: "materiais"})
+	for name, value := range map[string]string{"registro": "R1", "auto": "55", "item": "3"} {
+		err := ops.SetCustomField("mat", ids[name], value)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := ops.Value("mat", ids["auto"]); got != "opt1" {
+		t.Fatalf("expect dropdown stored as option ID, got '%v'", got)
+	}
+
+	err := m.Path(hooks.ActMoveCard, "mat", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "/operacoes/R1/auto_apreensao_55/item3_Celular/item3_Celular.dd"
+	if got := ops.Value("mat", ids["path"]); got != expect {
+		t.Errorf("expect path '%s', got '%v'", expect, got)
+	}
+}
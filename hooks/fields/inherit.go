@@ -0,0 +1,152 @@
+package fields
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/pkg/errors"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+)
+
+// InheritRule copies a value from an ancestor into a custom field.
+type InheritRule struct {
+	// Field is the name of the custom field that receives the value.
+	Field string `json:"field"`
+	// From is the name of the custom field read from the ancestor. It
+	// defaults to Field.
+	From string `json:"from"`
+	// FromTitle reads the title of the ancestor instead of a custom field.
+	FromTitle bool `json:"fromTitle"`
+	// Level is the ancestor to read: 1 is the parent, 2 the grandparent and
+	// so on. Zero means the nearest ancestor that has a value.
+	Level int `json:"level"`
+}
+
+// Inherit returns a hook that applies the rules. When a card is created or
+// moved, empty fields are filled from its ancestors. When a custom field is
+// set in a card, the rules are applied again to all its descendants,
+// overwriting their values. See Reinherit for cards moved to another parent.
+func Inherit(rules []InheritRule) hooks.Hooker {
+	return func(act string, cardId string, ops hooks.Operations) error {
+		switch act {
+		case hooks.ActCreateCard, hooks.ActMoveCard:
+			card, err := ops.FindCard(cardId)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("could not find card: %s", cardId))
+			}
+			return inherit(ops, rules, card, false)
+		case hooks.ActSetCustomField:
+			return propagate(ops, rules, cardId)
+		}
+		return nil
+	}
+}
+
+// Reinherit returns a hook that applies the rules to a card and to all its
+// descendants, overwriting their values. It is meant for cards moved to
+// another parent, see child.Tracker.OnReparent.
+func Reinherit(rules []InheritRule) hooks.Hooker {
+	return func(act string, cardId string, ops hooks.Operations) error {
+		card, err := ops.FindCard(cardId)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("could not find card: %s", cardId))
+		}
+		err = inherit(ops, rules, card, true)
+		if err != nil {
+			return err
+		}
+		return propagate(ops, rules, cardId)
+	}
+}
+
+// propagate applies the rules to the descendants of cardID, nearest first,
+// so each card inherits the values already updated in its ancestors.
+func propagate(ops hooks.Operations, rules []InheritRule, cardID string) error {
+	descendants, err := ops.FindDescendants(cardID)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not find descendants of card: %s", cardID))
+	}
+	for _, c := range descendants {
+		err = inherit(ops, rules, c, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func inherit(ops hooks.Operations, rules []InheritRule, card hooks.CardMsg, overwrite bool) error {
+	if card.ParentID == "" {
+		return nil
+	}
+	ancestors, err := ops.FindAncestors(card.ID)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not find ancestors of card: %s", card.ID))
+	}
+	for _, rule := range rules {
+		fieldID, ok, err := ops.FindCustomField(rule.Field, card.BoardID)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("could not find custom field: %s", rule.Field))
+		}
+		if !ok {
+			// the board of the card does not have this field
+			continue
+		}
+		current, hasCurrent, err := hooks.CardFieldString(ops, card, fieldID)
+		if err != nil {
+			return err
+		}
+		if hasCurrent && !overwrite {
+			continue
+		}
+		value, ok, err := inheritedValue(ops, rule, ancestors)
+		if err != nil {
+			return err
+		}
+		if !ok || value == current {
+			continue
+		}
+		log.Println("fields.Inherit", card.ID, rule.Field, value)
+		err = ops.SetCustomField(card.ID, fieldID, value)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("could not update custom field %s", rule.Field))
+		}
+	}
+	return nil
+}
+
+// inheritedValue walks up the ancestors of a card, nearest first, looking
+// for the value the rule asks for.
+func inheritedValue(ops hooks.Operations, rule InheritRule, ancestors []hooks.CardMsg) (string, bool, error) {
+	from := rule.From
+	if from == "" {
+		from = rule.Field
+	}
+	for i, ancestor := range ancestors {
+		level := i + 1
+		if rule.Level != 0 && level != rule.Level {
+			continue
+		}
+		if rule.FromTitle {
+			return ancestor.Title, true, nil
+		}
+		fieldID, ok, err := ops.FindCustomField(from, ancestor.BoardID)
+		if err != nil {
+			return "", false, errors.Wrap(err, fmt.Sprintf("could not find custom field: %s", from))
+		}
+		if ok {
+			value, ok, err := hooks.CardFieldString(ops, ancestor, fieldID)
+			if err != nil {
+				return "", false, err
+			}
+			if ok {
+				return value, true, nil
+			}
+		}
+		if rule.Level != 0 {
+			return "", false, nil
+		}
+	}
+	return "", false, nil
+}
@@ -0,0 +1,99 @@
+package fields
+
+import (
+	"testing"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+	"github.com/setecrs/wekan-hooks/hooks/child"
+	"github.com/setecrs/wekan-hooks/hooks/hookstest"
+)
+
+func TestInherit(t *testing.T) {
+	ops := hookstest.New()
+	iplAuto := ops.AddCustomField("ipls", "auto")
+	regAuto := ops.AddCustomField("registros", "auto")
+	matAuto := ops.AddCustomField("materiais", "auto")
+	matIPL := ops.AddCustomField("materiais", "ipl")
+	ops.AddCard(hooks.CardMsg{ID: "ipl", Title: "IPL 123", BoardID: "ipls"})
+	ops.AddCard(hooks.CardMsg{ID: "reg", Title: "Registro 1", BoardID: "registros", ParentID: "ipl"})
+	ops.AddCard(hooks.CardMsg{ID: "mat", Title: "Material 1", BoardID: "materiais", ParentID: "reg"})
+	ops.SetCustomField("ipl", iplAuto, "10")
+
+	inherit := Inherit([]InheritRule{
+		{Field: "auto"},
+		{Field: "ipl", FromTitle: true, Level: 2},
+	})
+	for _, id := range []string{"reg", "mat"} {
+		err := inherit(hooks.ActCreateCard, id, ops)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := ops.Value("reg", regAuto); got != "10" {
+		t.Errorf("expect registro auto '10', got '%v'", got)
+	}
+	if got := ops.Value("mat", matAuto); got != "10" {
+		t.Errorf("expect material auto '10', got '%v'", got)
+	}
+	if got := ops.Value("mat", matIPL); got != "IPL 123" {
+		t.Errorf("expect material ipl 'IPL 123', got '%v'", got)
+	}
+
+	// filled fields are kept on moves
+	ops.SetCustomField("mat", matAuto, "11")
+	err := inherit(hooks.ActMoveCard, "mat", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ops.Value("mat", matAuto); got != "11" {
+		t.Errorf("expect material auto '11', got '%v'", got)
+	}
+
+	// changes in an ancestor are propagated
+	ops.SetCustomField("ipl", iplAuto, "12")
+	err = inherit(hooks.ActSetCustomField, "ipl", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ops.Value("mat", matAuto); got != "12" {
+		t.Errorf("expect material auto '12', got '%v'", got)
+	}
+}
+
+func TestReinherit(t *testing.T) {
+	ops := hookstest.New()
+	iplAuto := ops.AddCustomField("ipls", "auto")
+	matAuto := ops.AddCustomField("materiais", "auto")
+	ops.AddCard(hooks.CardMsg{ID: "old", Title: "IPL 1", BoardID: "ipls"})
+	ops.AddCard(hooks.CardMsg{ID: "new", Title: "IPL 2", BoardID: "ipls"})
+	ops.AddCard(hooks.CardMsg{ID: "mat", Title: "Material 1", BoardID: "materiais", ParentID: "old"})
+	ops.AddCard(hooks.CardMsg{ID: "sub", Title: "Material 1.1", BoardID: "materiais", ParentID: "mat"})
+	ops.SetCustomField("old", iplAuto, "10")
+	ops.SetCustomField("new", iplAuto, "20")
+
+	rules := []InheritRule{{Field: "auto"}}
+	tracker := child.NewTracker("", nil)
+	reparent := tracker.OnReparent(Reinherit(rules))
+	for _, id := range []string{"mat", "sub"} {
+		for _, h := range []hooks.Hooker{tracker.Creation, Inherit(rules), reparent} {
+			err := h(hooks.ActCreateCard, id, ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if got := ops.Value("sub", matAuto); got != "10" {
+		t.Fatalf("expect auto '10', got '%v'", got)
+	}
+
+	ops.Cards["mat"].ParentID = "new"
+	err := reparent(hooks.ActMoveCard, "mat", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"mat", "sub"} {
+		if got := ops.Value(id, matAuto); got != "20" {
+			t.Errorf("%s: expect auto '20', got '%v'", id, got)
+		}
+	}
+}
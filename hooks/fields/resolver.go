@@ -0,0 +1,65 @@
+package fields
+
+import (
+	"sync"
+	"time"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+)
+
+// ResolverTTL is how long the IDs of the custom fields of a board are kept
+// before being searched again.
+const ResolverTTL = 10 * time.Minute
+
+// resolver caches the IDs returned by resolveIDs, by board. It is safe for
+// concurrent use.
+type resolver struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	now    func() time.Time
+	boards []string
+	cache  map[string]resolved
+}
+
+type resolved struct {
+	ids     CustomFieldsIDs
+	ok      bool
+	expires time.Time
+}
+
+func newResolver(boards []string, ttl time.Duration) *resolver {
+	return &resolver{ttl: ttl, now: time.Now, boards: boards, cache: make(map[string]resolved)}
+}
+
+// get returns the cached IDs of the board, or resolves them again if they
+// expired or were invalidated. ok is false if the board is not one of the
+// boards of the resolver.
+func (r *resolver) get(ops hooks.Operations, boardID string) (CustomFieldsIDs, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, found := r.cache[boardID]; found && r.now().Before(c.expires) {
+		return c.ids, c.ok, nil
+	}
+	ids, ok, err := resolveIDs(ops, r.boards, boardID)
+	if err != nil {
+		return CustomFieldsIDs{}, false, err
+	}
+	r.cache[boardID] = resolved{ids: ids, ok: ok, expires: r.now().Add(r.ttl)}
+	return ids, ok, nil
+}
+
+// invalidate makes the next get resolve the IDs again.
+func (r *resolver) invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = make(map[string]resolved)
+}
+
+// Refresh drops the cached IDs when a custom field is created, since it may
+// replace one that was removed.
+func (m *Materiais) Refresh(act string, cardId string, ops hooks.Operations) error {
+	if act == hooks.ActCreateCustomField {
+		m.ids.invalidate()
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package fields
+
+import (
+	"testing"
+	"time"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+	"github.com/setecrs/wekan-hooks/hooks/hookstest"
+)
+
+func TestResolver(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddBoard(hooks.Board{ID: "materiais", Title: "Materiais"})
+	for _, name := range []string{"ipl", "registro", "solicitacao", "auto", "item", "erro", "path"} {
+		ops.AddCustomField("materiais", name)
+	}
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	r := newResolver([]string{"Materiais"}, time.Minute)
+	r.now = func() time.Time { return now }
+
+	ids, ok, err := r.get(ops, "materiais")
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	first := ids.ipl
+
+	// recreated field is not seen while cached
+	ops.AddCustomField("materiais", "ipl")
+	ids, _, _ = r.get(ops, "materiais")
+	if ids.ipl != first {
+		t.Errorf("expect cached ipl '%s', got '%s'", first, ids.ipl)
+	}
+
+	now = now.Add(time.Minute)
+	ids, _, _ = r.get(ops, "materiais")
+	if ids.ipl == first {
+		t.Errorf("expect ipl resolved again after ttl")
+	}
+
+	second := ids.ipl
+	ops.AddCustomField("materiais", "ipl")
+	r.invalidate()
+	ids, _, _ = r.get(ops, "materiais")
+	if ids.ipl == second {
+		t.Errorf("expect ipl resolved again after invalidate")
+	}
+}
+
+func TestResolverMissingField(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddBoard(hooks.Board{ID: "materiais", Title: "Materiais"})
+	r := newResolver([]string{"Materiais"}, time.Minute)
+	_, _, err := r.get(ops, "materiais")
+	if err == nil {
+		t.Errorf("expect error for missing custom fields")
+	}
+}
+
+func TestResolverOtherBoard(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddBoard(hooks.Board{ID: "outro", Title: "Outro"})
+	r := newResolver([]string{"Materiais"}, time.Minute)
+	_, ok, err := r.get(ops, "outro")
+	if err != nil || ok {
+		t.Errorf("expect board outside the resolver ignored, got %v %v", ok, err)
+	}
+}
+
+func TestResolverStaleField(t *testing.T) {
+	ops, ids := newMateriais()
+	m := NewMateriais([]string{"Materiais"}, "")
+	ops.AddCard(hooks.CardMsg{ID: "ipl", Title: "IPL 123/2019", BoardID: "ipls"})
+	ops.AddCard(hooks.CardMsg{ID: "reg", Title: "Registro", BoardID: "registros", ParentID: "ipl"})
+	ops.AddCard(hooks.CardMsg{ID: "mat", Title: "Celular", BoardID: "materiais", ParentID: "reg"})
+	ops.AddCard(hooks.CardMsg{ID: "mat2", Title: "Notebook", BoardID: "materiais", ParentID: "reg"})
+	err := m.IPL(hooks.ActMoveCard, "mat", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ipl is deleted and created again, without a createCustomField event
+	delete(ops.CustomFields, ids["ipl"])
+	ipl := ops.AddCustomField("materiais", "ipl")
+	err = m.IPL(hooks.ActMoveCard, "mat2", ops)
+	if err == nil {
+		t.Fatal("expect error writing a deleted custom field")
+	}
+	if got := ops.Value("mat2", ids["ipl"]); got != nil {
+		t.Errorf("expect no value in the deleted field, got '%v'", got)
+	}
+	err = m.IPL(hooks.ActMoveCard, "mat2", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ops.Value("mat2", ipl); got != "IPL 123/2019" {
+		t.Errorf("expect ipl in the new field, got '%v'", got)
+	}
+}
@@ -1,20 +1,174 @@
 package hooks
 
+import (
+	"text/template"
+	"time"
+)
+
+// CardMsg mirrors a document of the cards collection. Fields that Wekan
+// may leave null are pointers, since null can not be decoded into a string
+// or a time.
 type CardMsg struct {
-	ID           string `bson:"_id"`
-	Title        string `bson:"title"`
-	ParentID     string `bson:"parentId"`
-	BoardID      string `bson:"boardId"`
-	CustomFields []struct {
-		ID    string      `bson:"_id"`
-		Value interface{} `bson:"value"`
-	} `bson:"customFields"`
+	ID               string             `bson:"_id"`
+	Title            string             `bson:"title"`
+	Description      *string            `bson:"description"`
+	ParentID         string             `bson:"parentId"`
+	BoardID          string             `bson:"boardId"`
+	ListID           string             `bson:"listId"`
+	SwimlaneID       string             `bson:"swimlaneId"`
+	UserID           string             `bson:"userId"`
+	Sort             float64            `bson:"sort"`
+	Type             *string            `bson:"type"`
+	LinkedID         *string            `bson:"linkedId"`
+	Color            *string            `bson:"color"`
+	CoverID          *string            `bson:"coverId"`
+	Archived         bool               `bson:"archived"`
+	ArchivedAt       *time.Time         `bson:"archivedAt"`
+	LabelIDs         []string           `bson:"labelIds"`
+	Members          []string           `bson:"members"`
+	Assignees        []string           `bson:"assignees"`
+	RequestedBy      *string            `bson:"requestedBy"`
+	AssignedBy       *string            `bson:"assignedBy"`
+	ReceivedAt       *time.Time         `bson:"receivedAt"`
+	StartAt          *time.Time         `bson:"startAt"`
+	DueAt            *time.Time         `bson:"dueAt"`
+	EndAt            *time.Time         `bson:"endAt"`
+	SpentTime        *float64           `bson:"spentTime"`
+	IsOvertime       bool               `bson:"isOvertime"`
+	CreatedAt        *time.Time         `bson:"createdAt"`
+	ModifiedAt       *time.Time         `bson:"modifiedAt"`
+	DateLastActivity *time.Time         `bson:"dateLastActivity"`
+	CustomFields     []CustomFieldValue `bson:"customFields"`
+}
+
+type CustomFieldValue struct {
+	ID    string      `bson:"_id"`
+	Value interface{} `bson:"value"`
+}
+
+type Board struct {
+	ID          string        `bson:"_id"`
+	Title       string        `bson:"title"`
+	Slug        *string       `bson:"slug"`
+	Description *string       `bson:"description"`
+	Archived    bool          `bson:"archived"`
+	Permission  *string       `bson:"permission"`
+	Color       *string       `bson:"color"`
+	Type        *string       `bson:"type"`
+	Labels      []Label       `bson:"labels"`
+	Members     []BoardMember `bson:"members"`
+	CreatedAt   *time.Time    `bson:"createdAt"`
+	ModifiedAt  *time.Time    `bson:"modifiedAt"`
+}
+
+type BoardMember struct {
+	UserID        string `bson:"userId"`
+	IsAdmin       bool   `bson:"isAdmin"`
+	IsActive      bool   `bson:"isActive"`
+	IsNoComments  bool   `bson:"isNoComments"`
+	IsCommentOnly bool   `bson:"isCommentOnly"`
+}
+
+type Label struct {
+	ID    string  `bson:"_id"`
+	Name  string  `bson:"name"`
+	Color *string `bson:"color"`
+}
+
+type List struct {
+	ID         string     `bson:"_id"`
+	Title      string     `bson:"title"`
+	BoardID    string     `bson:"boardId"`
+	SwimlaneID string     `bson:"swimlaneId"`
+	Archived   bool       `bson:"archived"`
+	Sort       float64    `bson:"sort"`
+	Color      *string    `bson:"color"`
+	CreatedAt  *time.Time `bson:"createdAt"`
+}
+
+type Swimlane struct {
+	ID        string     `bson:"_id"`
+	Title     string     `bson:"title"`
+	BoardID   string     `bson:"boardId"`
+	Archived  bool       `bson:"archived"`
+	Sort      float64    `bson:"sort"`
+	Color     *string    `bson:"color"`
+	Type      *string    `bson:"type"`
+	CreatedAt *time.Time `bson:"createdAt"`
+}
+
+type User struct {
+	ID        string      `bson:"_id"`
+	Username  string      `bson:"username"`
+	Emails    []UserEmail `bson:"emails"`
+	Profile   UserProfile `bson:"profile"`
+	IsAdmin   bool        `bson:"isAdmin"`
+	CreatedAt *time.Time  `bson:"createdAt"`
+}
+
+type UserEmail struct {
+	Address  string `bson:"address"`
+	Verified bool   `bson:"verified"`
+}
+
+type UserProfile struct {
+	Fullname  string `bson:"fullname"`
+	Initials  string `bson:"initials"`
+	AvatarURL string `bson:"avatarUrl"`
+}
+
+type CustomField struct {
+	ID       string              `bson:"_id"`
+	Name     string              `bson:"name"`
+	Type     string              `bson:"type"`
+	Settings CustomFieldSettings `bson:"settings"`
+	BoardIDs []string            `bson:"boardIds"`
+}
+
+type CustomFieldSettings struct {
+	DropdownItems []DropdownItem `bson:"dropdownItems"`
+	CurrencyCode  string         `bson:"currencyCode"`
+}
+
+type DropdownItem struct {
+	ID   string `bson:"_id"`
+	Name string `bson:"name"`
 }
 
 type Checklist struct {
-	ID     string `bson:"_id"`
-	Title  string `bson:"title"`
-	CardID string `bson:"cardId"`
+	ID         string     `bson:"_id"`
+	Title      string     `bson:"title"`
+	CardID     string     `bson:"cardId"`
+	Sort       float64    `bson:"sort"`
+	CreatedAt  time.Time  `bson:"createdAt"`
+	FinishedAt *time.Time `bson:"finishedAt,omitempty"`
+	// LinkedCardID is the child card this checklist tracks, if any.
+	LinkedCardID string `bson:"linkedCardId,omitempty"`
+}
+
+type ChecklistItem struct {
+	ID          string  `bson:"_id"`
+	Title       string  `bson:"title"`
+	ChecklistID string  `bson:"checklistId"`
+	CardID      string  `bson:"cardId"`
+	Sort        float64 `bson:"sort"`
+	IsFinished  bool    `bson:"isFinished"`
+	// LinkedCardID is the card created from this item, if any.
+	LinkedCardID string `bson:"linkedCardId,omitempty"`
+}
+
+// CardFilter selects cards in FindCards. Empty fields match any card.
+type CardFilter struct {
+	BoardID    string
+	ListID     string
+	SwimlaneID string
+	// Archived, if set, matches only archived or only active cards.
+	Archived *bool
+	// Title is a regular expression the title must match.
+	Title string
+	// CustomFields maps custom field IDs to the value the card must have,
+	// as stored by SetCustomField.
+	CustomFields map[string]interface{}
 }
 
 // Hooker receives an act and trigger some reaction
@@ -22,10 +176,62 @@ type Hooker func(act string, cardId string, ops Operations) error
 
 type Operations interface {
 	SetCheckListItem(cardId string, checkListTitle string, itemTitle string, isFinished bool) error
+	FindChecklists(cardID string) ([]Checklist, error)
+	FindChecklistItems(checklistIDs ...string) ([]ChecklistItem, error)
+	FindLinkedChecklists(linkedCardIDs ...string) ([]Checklist, error)
+	CreateChecklist(cardID, title string) (id string, err error)
+	RenameChecklist(checklistID, title string) error
+	LinkChecklist(checklistID, linkedCardID string) error
+	MoveChecklist(checklistID, cardID string) error
+	RemoveChecklist(checklistID string) error
+	AddChecklistItem(checklistID, title string, isFinished bool) (id string, err error)
+	RenameChecklistItem(itemID, title string) error
+	RemoveChecklistItem(itemID string) error
+	SetChecklistItemFinished(itemID string, isFinished bool) error
+	LinkChecklistItem(itemID, linkedCardID string) error
+	// ClaimChecklistItem links the item only if it is not linked yet, and
+	// reports whether it did.
+	ClaimChecklistItem(itemID, linkedCardID string) (ok bool, err error)
 	FindCard(cardId string) (CardMsg, error)
+	FindChildren(cardID string) ([]CardMsg, error)
+	FindDescendants(cardID string) ([]CardMsg, error)
+	FindAncestors(cardID string) ([]CardMsg, error)
+	FindSiblings(cardID string) ([]CardMsg, error)
+	FindCards(filter CardFilter) ([]CardMsg, error)
+	CreateCard(boardID, listID, swimlaneID, title, parentID string) (id string, err error)
+	// RemoveCard deletes a card created by the hooks, and its activities.
+	RemoveCard(cardID string) error
 	FindBoard(title string) (id string, ok bool, err error)
+	FindBoardByID(boardID string) (Board, error)
+	FindList(boardID, title string) (id string, ok bool, err error)
+	FindListByID(listID string) (List, error)
+	FindLists(boardID string) ([]List, error)
+	FindSwimlane(boardID, title string) (id string, ok bool, err error)
+	FindSwimlaneByID(swimlaneID string) (Swimlane, error)
+	FindSwimlanes(boardID string) ([]Swimlane, error)
+	FindUser(userID string) (User, error)
+	FindUserByUsername(username string) (user User, ok bool, err error)
+	MoveCard(cardID, listID, swimlaneID string) error
+	ArchiveCard(cardID string) error
+	RestoreCard(cardID string) error
+	AddLabel(cardID, labelID string) error
+	RemoveLabel(cardID, labelID string) error
+	AddMember(cardID, userID string) error
+	RemoveMember(cardID, userID string) error
+	AddAssignee(cardID, userID string) error
+	RemoveAssignee(cardID, userID string) error
+	SetDueDate(cardID string, due time.Time) error
+	SetTitle(cardID, title string) error
+	SetDescription(cardID, description string) error
+	SetParent(cardID, parentID string) error
+	AddComment(cardID, text string) (id string, err error)
+	// CommentTemplate returns the template of the comment named name, or
+	// nil if it is not configured.
+	CommentTemplate(name string) *template.Template
 	FindCustomField(title, boardId string) (id string, ok bool, err error)
+	FindCustomFieldByID(fieldID string) (def CustomField, ok bool, err error)
 	SetCustomField(cardID, fieldID, value string) error
+	SetCustomFieldValue(cardID, fieldID string, value interface{}) error
 }
 
 const ActAddBoardMember = "act-addBoardMember"
@@ -41,6 +247,7 @@ const ActCreateCard = "act-createCard"
 const ActCreateCustomField = "act-createCustomField"
 const ActCreateList = "act-createList"
 const ActCreateSwimlane = "act-createSwimlane"
+const ActDeleteCard = "act-deleteCard"
 const ActJoinMember = "act-joinMember"
 const ActMoveCard = "act-moveCard"
 const ActRemoveChecklist = "act-removeChecklist"
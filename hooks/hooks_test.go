@@ -0,0 +1,66 @@
+package hooks
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDecodeCard(t *testing.T) {
+	due := time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC)
+	buf, err := bson.Marshal(bson.M{
+		"_id":         "c1",
+		"title":       "Celular",
+		"listId":      "l1",
+		"swimlaneId":  "s1",
+		"labelIds":    []string{"a"},
+		"members":     []string{"u1"},
+		"archived":    false,
+		"dueAt":       due,
+		"startAt":     nil,
+		"spentTime":   nil,
+		"color":       nil,
+		"description": nil,
+		"createdAt":   nil,
+		"sort":        2.5,
+		"customFields": []bson.M{
+			{"_id": "f1", "value": "x"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	card := CardMsg{}
+	err = bson.Unmarshal(buf, &card)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if card.ListID != "l1" || card.SwimlaneID != "s1" || card.Sort != 2.5 {
+		t.Errorf("unexpected card: %+v", card)
+	}
+	if len(card.LabelIDs) != 1 || len(card.Members) != 1 || len(card.CustomFields) != 1 {
+		t.Errorf("unexpected card: %+v", card)
+	}
+	if card.DueAt == nil || !card.DueAt.Equal(due) {
+		t.Errorf("dueAt: %v", card.DueAt)
+	}
+	if card.StartAt != nil || card.SpentTime != nil || card.Color != nil || card.Description != nil || card.CreatedAt != nil {
+		t.Errorf("null fields should stay nil: %+v", card)
+	}
+}
+
+func TestUserDecodeNull(t *testing.T) {
+	buf, err := bson.Marshal(bson.M{"_id": "u1", "username": "bot", "createdAt": nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := User{}
+	err = bson.Unmarshal(buf, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "bot" || user.CreatedAt != nil {
+		t.Errorf("unexpected user: %+v", user)
+	}
+}
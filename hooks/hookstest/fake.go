@@ -0,0 +1,641 @@
+// Package hookstest provides an in-memory hooks.Operations for tests.
+package hookstest
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"text/template"
+	"time"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+)
+
+// Fake keeps cards and checklists in memory. Operations not implemented
+// by Fake panic through the embedded nil interface.
+type Fake struct {
+	hooks.Operations
+	Boards         map[string]*hooks.Board
+	Cards          map[string]*hooks.CardMsg
+	Checklists     map[string]*hooks.Checklist
+	ChecklistItems map[string]*hooks.ChecklistItem
+	// CustomFieldIDs maps board ID and custom field name to its ID.
+	CustomFieldIDs map[[2]string]string
+	// CustomFields are the definitions of the custom fields, by ID.
+	CustomFields map[string]*hooks.CustomField
+	// Lists and Swimlanes map board ID and title to an ID.
+	Lists     map[[2]string]string
+	Swimlanes map[[2]string]string
+	// Comments maps a card ID to the text of its comments.
+	Comments map[string][]string
+	// Templates are returned by CommentTemplate.
+	Templates map[string]*template.Template
+	nextID    int
+}
+
+func New() *Fake {
+	return &Fake{
+		Boards:         make(map[string]*hooks.Board),
+		Cards:          make(map[string]*hooks.CardMsg),
+		Checklists:     make(map[string]*hooks.Checklist),
+		ChecklistItems: make(map[string]*hooks.ChecklistItem),
+		CustomFieldIDs: make(map[[2]string]string),
+		CustomFields:   make(map[string]*hooks.CustomField),
+		Lists:          make(map[[2]string]string),
+		Swimlanes:      make(map[[2]string]string),
+		Comments:       make(map[string][]string),
+		Templates:      make(map[string]*template.Template),
+	}
+}
+
+func (f *Fake) newID() string {
+	f.nextID++
+	return fmt.Sprintf("id%d", f.nextID)
+}
+
+// AddBoard stores a copy of board.
+func (f *Fake) AddBoard(board hooks.Board) {
+	f.Boards[board.ID] = &board
+}
+
+// AddCard stores a copy of card.
+func (f *Fake) AddCard(card hooks.CardMsg) {
+	f.Cards[card.ID] = &card
+}
+
+// Items returns the items of the checklist with the given title in the card,
+// mapped to whether they are finished.
+func (f *Fake) Items(cardID, checklistTitle string) map[string]bool {
+	for _, c := range f.Checklists {
+		if c.CardID != cardID || c.Title != checklistTitle {
+			continue
+		}
+		result := make(map[string]bool)
+		for _, item := range f.ChecklistItems {
+			if item.ChecklistID == c.ID {
+				result[item.Title] = item.IsFinished
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// AddCustomField defines a text custom field in a board and returns its ID.
+func (f *Fake) AddCustomField(boardID, name string) string {
+	return f.AddTypedCustomField(boardID, hooks.CustomField{Name: name, Type: hooks.CustomFieldText})
+}
+
+// AddTypedCustomField defines a custom field in a board and returns its ID.
+// The ID of def is ignored.
+func (f *Fake) AddTypedCustomField(boardID string, def hooks.CustomField) string {
+	def.ID = f.newID()
+	def.BoardIDs = []string{boardID}
+	f.CustomFieldIDs[[2]string{boardID, def.Name}] = def.ID
+	f.CustomFields[def.ID] = &def
+	return def.ID
+}
+
+// Value returns the value of a custom field of a card.
+func (f *Fake) Value(cardID, fieldID string) interface{} {
+	card, ok := f.Cards[cardID]
+	if !ok {
+		return nil
+	}
+	for _, cf := range card.CustomFields {
+		if cf.ID == fieldID {
+			return cf.Value
+		}
+	}
+	return nil
+}
+
+func (f *Fake) FindCustomField(name, boardID string) (string, bool, error) {
+	id, ok := f.CustomFieldIDs[[2]string{boardID, name}]
+	return id, ok, nil
+}
+
+func (f *Fake) FindCustomFieldByID(fieldID string) (hooks.CustomField, bool, error) {
+	def, ok := f.CustomFields[fieldID]
+	if !ok {
+		return hooks.CustomField{}, false, nil
+	}
+	return *def, true, nil
+}
+
+func (f *Fake) SetCustomField(cardID, fieldID, value string) error {
+	def, ok, _ := f.FindCustomFieldByID(fieldID)
+	if !ok {
+		return fmt.Errorf("custom field not found: %s", fieldID)
+	}
+	v, err := def.Parse(value)
+	if err != nil {
+		return err
+	}
+	return f.SetCustomFieldValue(cardID, fieldID, v)
+}
+
+func (f *Fake) SetCustomFieldValue(cardID, fieldID string, value interface{}) error {
+	card, ok := f.Cards[cardID]
+	if !ok {
+		return fmt.Errorf("card not found: %s", cardID)
+	}
+	for i, cf := range card.CustomFields {
+		if cf.ID == fieldID {
+			card.CustomFields[i].Value = value
+			return nil
+		}
+	}
+	card.CustomFields = append(card.CustomFields, hooks.CustomFieldValue{ID: fieldID, Value: value})
+	return nil
+}
+
+func (f *Fake) FindCard(cardID string) (hooks.CardMsg, error) {
+	card, ok := f.Cards[cardID]
+	if !ok {
+		return hooks.CardMsg{}, fmt.Errorf("card not found: %s", cardID)
+	}
+	return *card, nil
+}
+
+func (f *Fake) FindChildren(cardID string) ([]hooks.CardMsg, error) {
+	result := []hooks.CardMsg{}
+	for _, c := range f.Cards {
+		if c.ParentID == cardID {
+			result = append(result, *c)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (f *Fake) FindDescendants(cardID string) ([]hooks.CardMsg, error) {
+	result := []hooks.CardMsg{}
+	visited := map[string]bool{cardID: true}
+	queue := []string{cardID}
+	for len(queue) > 0 {
+		children, _ := f.FindChildren(queue[0])
+		queue = queue[1:]
+		for _, c := range children {
+			if visited[c.ID] {
+				continue
+			}
+			visited[c.ID] = true
+			result = append(result, c)
+			queue = append(queue, c.ID)
+		}
+	}
+	return result, nil
+}
+
+func (f *Fake) FindAncestors(cardID string) ([]hooks.CardMsg, error) {
+	result := []hooks.CardMsg{}
+	card, err := f.card(cardID)
+	if err != nil {
+		return nil, err
+	}
+	visited := map[string]bool{cardID: true}
+	for id := card.ParentID; id != "" && !visited[id]; {
+		visited[id] = true
+		parent, ok := f.Cards[id]
+		if !ok {
+			break
+		}
+		result = append(result, *parent)
+		id = parent.ParentID
+	}
+	return result, nil
+}
+
+func (f *Fake) FindSiblings(cardID string) ([]hooks.CardMsg, error) {
+	card, err := f.card(cardID)
+	if err != nil {
+		return nil, err
+	}
+	result := []hooks.CardMsg{}
+	if card.ParentID == "" {
+		return result, nil
+	}
+	children, _ := f.FindChildren(card.ParentID)
+	for _, c := range children {
+		if c.ID != cardID {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+func (f *Fake) FindCards(filter hooks.CardFilter) ([]hooks.CardMsg, error) {
+	var title *regexp.Regexp
+	if filter.Title != "" {
+		var err error
+		title, err = regexp.Compile(filter.Title)
+		if err != nil {
+			return nil, err
+		}
+	}
+	result := []hooks.CardMsg{}
+	for _, c := range f.Cards {
+		switch {
+		case filter.BoardID != "" && c.BoardID != filter.BoardID,
+			filter.ListID != "" && c.ListID != filter.ListID,
+			filter.SwimlaneID != "" && c.SwimlaneID != filter.SwimlaneID,
+			filter.Archived != nil && c.Archived != *filter.Archived,
+			title != nil && !title.MatchString(c.Title):
+			continue
+		}
+		matches := 0
+		for id, value := range filter.CustomFields {
+			for _, cf := range c.CustomFields {
+				if cf.ID == id && cf.Value == value {
+					matches++
+					break
+				}
+			}
+		}
+		if matches == len(filter.CustomFields) {
+			result = append(result, *c)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (f *Fake) FindChecklists(cardID string) ([]hooks.Checklist, error) {
+	result := []hooks.Checklist{}
+	for _, c := range f.Checklists {
+		if c.CardID == cardID {
+			result = append(result, *c)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Sort < result[j].Sort })
+	return result, nil
+}
+
+func (f *Fake) FindLinkedChecklists(linkedCardIDs ...string) ([]hooks.Checklist, error) {
+	result := []hooks.Checklist{}
+	for _, c := range f.Checklists {
+		if c.LinkedCardID != "" && contains(linkedCardIDs, c.LinkedCardID) {
+			result = append(result, *c)
+		}
+	}
+	return result, nil
+}
+
+func (f *Fake) FindChecklistItems(checklistIDs ...string) ([]hooks.ChecklistItem, error) {
+	result := []hooks.ChecklistItem{}
+	for _, item := range f.ChecklistItems {
+		if contains(checklistIDs, item.ChecklistID) {
+			result = append(result, *item)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Sort < result[j].Sort })
+	return result, nil
+}
+
+func (f *Fake) CreateChecklist(cardID, title string) (string, error) {
+	checklists, _ := f.FindChecklists(cardID)
+	id := f.newID()
+	f.Checklists[id] = &hooks.Checklist{ID: id, CardID: cardID, Title: title, Sort: float64(len(checklists))}
+	return id, nil
+}
+
+func (f *Fake) RenameChecklist(checklistID, title string) error {
+	c, ok := f.Checklists[checklistID]
+	if !ok {
+		return fmt.Errorf("checklist not found: %s", checklistID)
+	}
+	c.Title = title
+	return nil
+}
+
+func (f *Fake) LinkChecklist(checklistID, linkedCardID string) error {
+	c, ok := f.Checklists[checklistID]
+	if !ok {
+		return fmt.Errorf("checklist not found: %s", checklistID)
+	}
+	c.LinkedCardID = linkedCardID
+	return nil
+}
+
+func (f *Fake) AddChecklistItem(checklistID, title string, isFinished bool) (string, error) {
+	c, ok := f.Checklists[checklistID]
+	if !ok {
+		return "", fmt.Errorf("checklist not found: %s", checklistID)
+	}
+	items, _ := f.FindChecklistItems(checklistID)
+	id := f.newID()
+	f.ChecklistItems[id] = &hooks.ChecklistItem{
+		ID:          id,
+		ChecklistID: checklistID,
+		CardID:      c.CardID,
+		Title:       title,
+		IsFinished:  isFinished,
+		Sort:        float64(len(items)),
+	}
+	return id, nil
+}
+
+func (f *Fake) RenameChecklistItem(itemID, title string) error {
+	item, ok := f.ChecklistItems[itemID]
+	if !ok {
+		return fmt.Errorf("checklistItem not found: %s", itemID)
+	}
+	item.Title = title
+	return nil
+}
+
+func (f *Fake) RemoveChecklistItem(itemID string) error {
+	delete(f.ChecklistItems, itemID)
+	return nil
+}
+
+func (f *Fake) SetChecklistItemFinished(itemID string, isFinished bool) error {
+	item, ok := f.ChecklistItems[itemID]
+	if !ok {
+		return fmt.Errorf("checklistItem not found: %s", itemID)
+	}
+	item.IsFinished = isFinished
+	return nil
+}
+
+func (f *Fake) MoveChecklist(checklistID, cardID string) error {
+	c, ok := f.Checklists[checklistID]
+	if !ok {
+		return fmt.Errorf("checklist not found: %s", checklistID)
+	}
+	checklists, _ := f.FindChecklists(cardID)
+	c.CardID = cardID
+	c.Sort = float64(len(checklists))
+	for _, item := range f.ChecklistItems {
+		if item.ChecklistID == checklistID {
+			item.CardID = cardID
+		}
+	}
+	return nil
+}
+
+func (f *Fake) RemoveChecklist(checklistID string) error {
+	for id, item := range f.ChecklistItems {
+		if item.ChecklistID == checklistID {
+			delete(f.ChecklistItems, id)
+		}
+	}
+	delete(f.Checklists, checklistID)
+	return nil
+}
+
+// AddList defines a list in a board and returns its ID.
+func (f *Fake) AddList(boardID, title string) string {
+	id := f.newID()
+	f.Lists[[2]string{boardID, title}] = id
+	return id
+}
+
+func (f *Fake) FindList(boardID, title string) (string, bool, error) {
+	id, ok := f.Lists[[2]string{boardID, title}]
+	return id, ok, nil
+}
+
+func (f *Fake) FindListByID(listID string) (hooks.List, error) {
+	for k, id := range f.Lists {
+		if id == listID {
+			return hooks.List{ID: id, BoardID: k[0], Title: k[1]}, nil
+		}
+	}
+	return hooks.List{}, fmt.Errorf("list not found: %s", listID)
+}
+
+func (f *Fake) FindSwimlane(boardID, title string) (string, bool, error) {
+	id, ok := f.Swimlanes[[2]string{boardID, title}]
+	return id, ok, nil
+}
+
+func (f *Fake) MoveCard(cardID, listID, swimlaneID string) error {
+	card, ok := f.Cards[cardID]
+	if !ok {
+		return fmt.Errorf("card not found: %s", cardID)
+	}
+	card.ListID = listID
+	if swimlaneID != "" {
+		card.SwimlaneID = swimlaneID
+	}
+	return nil
+}
+
+func (f *Fake) card(cardID string) (*hooks.CardMsg, error) {
+	card, ok := f.Cards[cardID]
+	if !ok {
+		return nil, fmt.Errorf("card not found: %s", cardID)
+	}
+	return card, nil
+}
+
+func (f *Fake) ArchiveCard(cardID string) error {
+	card, err := f.card(cardID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	card.Archived = true
+	card.ArchivedAt = &now
+	return nil
+}
+
+func (f *Fake) RestoreCard(cardID string) error {
+	card, err := f.card(cardID)
+	if err != nil {
+		return err
+	}
+	card.Archived = false
+	return nil
+}
+
+func (f *Fake) AddLabel(cardID, labelID string) error {
+	card, err := f.card(cardID)
+	if err != nil {
+		return err
+	}
+	card.LabelIDs = addToSet(card.LabelIDs, labelID)
+	return nil
+}
+
+func (f *Fake) RemoveLabel(cardID, labelID string) error {
+	card, err := f.card(cardID)
+	if err != nil {
+		return err
+	}
+	card.LabelIDs = pull(card.LabelIDs, labelID)
+	return nil
+}
+
+func (f *Fake) AddMember(cardID, userID string) error {
+	card, err := f.card(cardID)
+	if err != nil {
+		return err
+	}
+	card.Members = addToSet(card.Members, userID)
+	return nil
+}
+
+func (f *Fake) RemoveMember(cardID, userID string) error {
+	card, err := f.card(cardID)
+	if err != nil {
+		return err
+	}
+	card.Members = pull(card.Members, userID)
+	return nil
+}
+
+func (f *Fake) AddAssignee(cardID, userID string) error {
+	card, err := f.card(cardID)
+	if err != nil {
+		return err
+	}
+	card.Assignees = addToSet(card.Assignees, userID)
+	return nil
+}
+
+func (f *Fake) RemoveAssignee(cardID, userID string) error {
+	card, err := f.card(cardID)
+	if err != nil {
+		return err
+	}
+	card.Assignees = pull(card.Assignees, userID)
+	return nil
+}
+
+func (f *Fake) SetDueDate(cardID string, due time.Time) error {
+	card, err := f.card(cardID)
+	if err != nil {
+		return err
+	}
+	card.DueAt = nil
+	if !due.IsZero() {
+		card.DueAt = &due
+	}
+	return nil
+}
+
+func (f *Fake) SetTitle(cardID, title string) error {
+	card, err := f.card(cardID)
+	if err != nil {
+		return err
+	}
+	card.Title = title
+	return nil
+}
+
+func (f *Fake) SetParent(cardID, parentID string) error {
+	card, err := f.card(cardID)
+	if err != nil {
+		return err
+	}
+	card.ParentID = parentID
+	return nil
+}
+
+func (f *Fake) SetDescription(cardID, description string) error {
+	card, err := f.card(cardID)
+	if err != nil {
+		return err
+	}
+	card.Description = &description
+	return nil
+}
+
+func (f *Fake) AddComment(cardID, text string) (string, error) {
+	if _, err := f.card(cardID); err != nil {
+		return "", err
+	}
+	f.Comments[cardID] = append(f.Comments[cardID], text)
+	return f.newID(), nil
+}
+
+func (f *Fake) CommentTemplate(name string) *template.Template {
+	return f.Templates[name]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func addToSet(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+func pull(values []string, value string) []string {
+	result := []string{}
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func (f *Fake) FindBoard(title string) (string, bool, error) {
+	for _, b := range f.Boards {
+		if b.Title == title {
+			return b.ID, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (f *Fake) FindBoardByID(boardID string) (hooks.Board, error) {
+	b, ok := f.Boards[boardID]
+	if !ok {
+		return hooks.Board{}, fmt.Errorf("board not found: %s", boardID)
+	}
+	return *b, nil
+}
+
+func (f *Fake) CreateCard(boardID, listID, swimlaneID, title, parentID string) (string, error) {
+	id := f.newID()
+	f.Cards[id] = &hooks.CardMsg{
+		ID:         id,
+		Title:      title,
+		BoardID:    boardID,
+		ListID:     listID,
+		SwimlaneID: swimlaneID,
+		ParentID:   parentID,
+	}
+	return id, nil
+}
+
+func (f *Fake) ClaimChecklistItem(itemID, linkedCardID string) (bool, error) {
+	item, ok := f.ChecklistItems[itemID]
+	if !ok {
+		return false, fmt.Errorf("checklistItem not found: %s", itemID)
+	}
+	if item.LinkedCardID != "" {
+		return false, nil
+	}
+	item.LinkedCardID = linkedCardID
+	return true, nil
+}
+
+func (f *Fake) RemoveCard(cardID string) error {
+	delete(f.Cards, cardID)
+	return nil
+}
+
+func (f *Fake) LinkChecklistItem(itemID, linkedCardID string) error {
+	item, ok := f.ChecklistItems[itemID]
+	if !ok {
+		return fmt.Errorf("checklistItem not found: %s", itemID)
+	}
+	item.LinkedCardID = linkedCardID
+	return nil
+}
@@ -0,0 +1,292 @@
+// Package templates fills new cards from a template.
+package templates
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/pkg/errors"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+)
+
+// Rule describes the template applied to the cards created in a list.
+type Rule struct {
+	// Board and List are the titles where the new cards are created.
+	Board string `json:"board"`
+	List  string `json:"list"`
+	// Card is the title of the template card. If not set, the template is
+	// given by Checklists, Labels, Fields and Description.
+	Card string `json:"card"`
+	// CardBoard is the title of the board of the template card. It defaults
+	// to Board.
+	CardBoard string `json:"cardBoard"`
+
+	Checklists []Checklist `json:"checklists"`
+	// Labels are label names.
+	Labels []string `json:"labels"`
+	// Fields maps custom field names to their default values.
+	Fields      map[string]string `json:"fields"`
+	Description string            `json:"description"`
+}
+
+// Checklist is a checklist of a template defined in the config.
+type Checklist struct {
+	Title string   `json:"title"`
+	Items []string `json:"items"`
+}
+
+// Apply returns a hook that copies the template of the rule into the cards
+// created in its list: the checklists and their items, the labels, the
+// custom fields and the description. Checklists with the same title, fields
+// with a value and a description already in the card are kept. Labels and
+// fields are matched by name, since each board has its own.
+func Apply(rule Rule) hooks.Hooker {
+	return func(act string, cardId string, ops hooks.Operations) error {
+		if act != hooks.ActCreateCard {
+			return nil
+		}
+		card, err := ops.FindCard(cardId)
+		if err != nil {
+			return err
+		}
+		ok, err := inList(ops, rule, card)
+		if err != nil || !ok {
+			return err
+		}
+		tmpl, ok, err := template(ops, rule, card)
+		if err != nil || !ok {
+			return err
+		}
+		log.Println("templates.Apply", card.ID, rule.Board, rule.List)
+		return apply(ops, tmpl, card)
+	}
+}
+
+// tmplCard is a template, read from a card or from the config.
+type tmplCard struct {
+	Checklists  []Checklist
+	Labels      []string
+	Fields      map[string]string
+	Description string
+}
+
+func inList(ops hooks.Operations, rule Rule, card hooks.CardMsg) (bool, error) {
+	list, err := ops.FindListByID(card.ListID)
+	if err != nil {
+		return false, errors.Wrap(err, "could not find list of card")
+	}
+	if list.Title != rule.List {
+		return false, nil
+	}
+	board, err := ops.FindBoardByID(card.BoardID)
+	if err != nil {
+		return false, errors.Wrap(err, fmt.Sprintf("could not find board: %s", card.BoardID))
+	}
+	return board.Title == rule.Board, nil
+}
+
+// template returns the template of the rule for the new card. ok is false
+// if the template card was not found, or if more than one card, other than
+// the new one, has its title.
+func template(ops hooks.Operations, rule Rule, card hooks.CardMsg) (tmpl tmplCard, ok bool, err error) {
+	if rule.Card == "" {
+		return tmplCard{
+			Checklists:  rule.Checklists,
+			Labels:      rule.Labels,
+			Fields:      rule.Fields,
+			Description: rule.Description,
+		}, true, nil
+	}
+	boardTitle := rule.CardBoard
+	if boardTitle == "" {
+		boardTitle = rule.Board
+	}
+	boardID, ok, err := ops.FindBoard(boardTitle)
+	if err != nil {
+		return tmpl, false, errors.Wrap(err, "could not find board")
+	}
+	if !ok {
+		return tmpl, false, fmt.Errorf("board not found: %s", boardTitle)
+	}
+	cards, err := ops.FindCards(hooks.CardFilter{
+		BoardID: boardID,
+		Title:   "^" + regexp.QuoteMeta(rule.Card) + "$",
+	})
+	if err != nil {
+		return tmpl, false, errors.Wrap(err, "could not search template card")
+	}
+	others := []hooks.CardMsg{}
+	for _, c := range cards {
+		if c.ID != card.ID {
+			others = append(others, c)
+		}
+	}
+	if len(others) == 0 {
+		log.Printf("templates.Apply: template card not found: %s", rule.Card)
+		return tmpl, false, nil
+	}
+	if len(others) > 1 {
+		log.Printf("templates.Apply: %d template cards found: %s", len(others), rule.Card)
+		return tmpl, false, nil
+	}
+	tmpl, err = fromCard(ops, others[0])
+	if err != nil {
+		return tmpl, false, err
+	}
+	return tmpl, true, nil
+}
+
+func fromCard(ops hooks.Operations, card hooks.CardMsg) (tmplCard, error) {
+	tmpl := tmplCard{Fields: make(map[string]string)}
+	if card.Description != nil {
+		tmpl.Description = *card.Description
+	}
+	checklists, err := ops.FindChecklists(card.ID)
+	if err != nil {
+		return tmpl, errors.Wrap(err, "could not find checklists of template")
+	}
+	for _, c := range checklists {
+		items, err := ops.FindChecklistItems(c.ID)
+		if err != nil {
+			return tmpl, errors.Wrap(err, "could not find checklist items of template")
+		}
+		checklist := Checklist{Title: c.Title}
+		for _, item := range items {
+			checklist.Items = append(checklist.Items, item.Title)
+		}
+		tmpl.Checklists = append(tmpl.Checklists, checklist)
+	}
+	if len(card.LabelIDs) > 0 {
+		board, err := ops.FindBoardByID(card.BoardID)
+		if err != nil {
+			return tmpl, errors.Wrap(err, fmt.Sprintf("could not find board: %s", card.BoardID))
+		}
+		for _, id := range card.LabelIDs {
+			for _, l := range board.Labels {
+				if l.ID == id {
+					tmpl.Labels = append(tmpl.Labels, l.Name)
+				}
+			}
+		}
+	}
+	for _, cf := range card.CustomFields {
+		if cf.Value == nil {
+			continue
+		}
+		def, ok, err := ops.FindCustomFieldByID(cf.ID)
+		if err != nil {
+			return tmpl, errors.Wrap(err, fmt.Sprintf("could not find custom field: %s", cf.ID))
+		}
+		if !ok {
+			// the value of a deleted custom field
+			continue
+		}
+		if s := def.Format(cf.Value); s != "" {
+			tmpl.Fields[def.Name] = s
+		}
+	}
+	return tmpl, nil
+}
+
+func apply(ops hooks.Operations, tmpl tmplCard, card hooks.CardMsg) error {
+	err := applyChecklists(ops, tmpl, card)
+	if err != nil {
+		return err
+	}
+	err = applyLabels(ops, tmpl, card)
+	if err != nil {
+		return err
+	}
+	err = applyFields(ops, tmpl, card)
+	if err != nil {
+		return err
+	}
+	if tmpl.Description != "" && (card.Description == nil || *card.Description == "") {
+		err = ops.SetDescription(card.ID, tmpl.Description)
+		if err != nil {
+			return errors.Wrap(err, "could not set description")
+		}
+	}
+	return nil
+}
+
+func applyChecklists(ops hooks.Operations, tmpl tmplCard, card hooks.CardMsg) error {
+	existing, err := ops.FindChecklists(card.ID)
+	if err != nil {
+		return errors.Wrap(err, "could not find checklists")
+	}
+	titles := make(map[string]bool)
+	for _, c := range existing {
+		titles[c.Title] = true
+	}
+	for _, c := range tmpl.Checklists {
+		if titles[c.Title] {
+			continue
+		}
+		id, err := ops.CreateChecklist(card.ID, c.Title)
+		if err != nil {
+			return errors.Wrap(err, "could not create checklist")
+		}
+		for _, item := range c.Items {
+			_, err = ops.AddChecklistItem(id, item, false)
+			if err != nil {
+				return errors.Wrap(err, "could not add checklist item")
+			}
+		}
+	}
+	return nil
+}
+
+func applyLabels(ops hooks.Operations, tmpl tmplCard, card hooks.CardMsg) error {
+	if len(tmpl.Labels) == 0 {
+		return nil
+	}
+	board, err := ops.FindBoardByID(card.BoardID)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not find board: %s", card.BoardID))
+	}
+	for _, name := range tmpl.Labels {
+		found := false
+		for _, l := range board.Labels {
+			if l.Name != name {
+				continue
+			}
+			found = true
+			err = ops.AddLabel(card.ID, l.ID)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("could not add label %s", name))
+			}
+		}
+		if !found {
+			log.Printf("templates.Apply: board %s has no label %s", board.Title, name)
+		}
+	}
+	return nil
+}
+
+func applyFields(ops hooks.Operations, tmpl tmplCard, card hooks.CardMsg) error {
+	for name, value := range tmpl.Fields {
+		fieldID, ok, err := ops.FindCustomField(name, card.BoardID)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("could not find custom field: %s", name))
+		}
+		if !ok {
+			// the board of the card does not have this field
+			continue
+		}
+		_, filled, err := hooks.CardFieldString(ops, card, fieldID)
+		if err != nil {
+			return err
+		}
+		if filled {
+			continue
+		}
+		err = ops.SetCustomField(card.ID, fieldID, value)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("could not set custom field %s", name))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package templates
+
+import (
+	"reflect"
+	"testing"
+
+	hooks "github.com/setecrs/wekan-hooks/hooks"
+	"github.com/setecrs/wekan-hooks/hooks/hookstest"
+)
+
+func TestApplyCard(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddBoard(hooks.Board{ID: "b1", Title: "Materiais", Labels: []hooks.Label{{ID: "l1", Name: "urgente"}}})
+	entrada := ops.AddList("b1", "Entrada")
+	outra := ops.AddList("b1", "Outra")
+	tipo := ops.AddCustomField("b1", "tipo")
+	description := "Descrição padrão"
+	ops.AddCard(hooks.CardMsg{ID: "modelo", Title: "Modelo", BoardID: "b1", ListID: entrada,
+		LabelIDs: []string{"l1"}, Description: &description})
+	ops.SetCustomField("modelo", tipo, "Celular")
+	// the value of a deleted custom field is skipped
+	ops.Cards["modelo"].CustomFields = append(ops.Cards["modelo"].CustomFields, hooks.CustomFieldValue{ID: "deleted", Value: "x"})
+	checklistID, _ := ops.CreateChecklist("modelo", "Exames")
+	ops.AddChecklistItem(checklistID, "Extração", true)
+	ops.AddChecklistItem(checklistID, "Laudo", false)
+	ops.AddCard(hooks.CardMsg{ID: "novo", Title: "Novo", BoardID: "b1", ListID: entrada})
+	ops.AddCard(hooks.CardMsg{ID: "fora", Title: "Fora", BoardID: "b1", ListID: outra})
+
+	apply := Apply(Rule{Board: "Materiais", List: "Entrada", Card: "Modelo"})
+	for _, id := range []string{"novo", "fora", "modelo"} {
+		err := apply(hooks.ActCreateCard, id, ops)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// applying again does not duplicate checklists
+	err := apply(hooks.ActCreateCard, "novo", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	novo := ops.Cards["novo"]
+	if got := ops.Items("novo", "Exames"); !reflect.DeepEqual(got, map[string]bool{"Extração": false, "Laudo": false}) {
+		t.Errorf("unexpected items: %v", got)
+	}
+	if checklists, _ := ops.FindChecklists("novo"); len(checklists) != 1 {
+		t.Errorf("expect 1 checklist, got %d", len(checklists))
+	}
+	if !reflect.DeepEqual(novo.LabelIDs, []string{"l1"}) {
+		t.Errorf("unexpected labels: %v", novo.LabelIDs)
+	}
+	if got := ops.Value("novo", tipo); got != "Celular" {
+		t.Errorf("expect tipo 'Celular', got '%v'", got)
+	}
+	if novo.Description == nil || *novo.Description != description {
+		t.Errorf("unexpected description: %v", novo.Description)
+	}
+	if checklists, _ := ops.FindChecklists("fora"); len(checklists) != 0 {
+		t.Errorf("expect card in other list unchanged")
+	}
+	if checklists, _ := ops.FindChecklists("modelo"); len(checklists) != 1 {
+		t.Errorf("expect template unchanged")
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddBoard(hooks.Board{ID: "b1", Title: "Materiais"})
+	entrada := ops.AddList("b1", "Entrada")
+	tipo := ops.AddCustomField("b1", "tipo")
+	ops.AddCard(hooks.CardMsg{ID: "novo", Title: "Novo", BoardID: "b1", ListID: entrada})
+	ops.SetCustomField("novo", tipo, "Notebook")
+
+	apply := Apply(Rule{
+		Board:      "Materiais",
+		List:       "Entrada",
+		Checklists: []Checklist{{Title: "Exames", Items: []string{"Laudo"}}},
+		Fields:     map[string]string{"tipo": "Celular"},
+	})
+	err := apply(hooks.ActCreateCard, "novo", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ops.Items("novo", "Exames"); !reflect.DeepEqual(got, map[string]bool{"Laudo": false}) {
+		t.Errorf("unexpected items: %v", got)
+	}
+	if got := ops.Value("novo", tipo); got != "Notebook" {
+		t.Errorf("expect tipo kept 'Notebook', got '%v'", got)
+	}
+}
+
+func TestApplyAmbiguous(t *testing.T) {
+	ops := hookstest.New()
+	ops.AddBoard(hooks.Board{ID: "b1", Title: "Materiais"})
+	entrada := ops.AddList("b1", "Entrada")
+	modelos := ops.AddList("b1", "Modelos")
+	for _, id := range []string{"modelo1", "modelo2"} {
+		ops.AddCard(hooks.CardMsg{ID: id, Title: "Modelo", BoardID: "b1", ListID: modelos})
+		ops.CreateChecklist(id, "Exames "+id)
+	}
+	ops.AddCard(hooks.CardMsg{ID: "novo", Title: "Novo", BoardID: "b1", ListID: entrada})
+
+	apply := Apply(Rule{Board: "Materiais", List: "Entrada", Card: "Modelo"})
+	err := apply(hooks.ActCreateCard, "novo", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checklists, _ := ops.FindChecklists("novo"); len(checklists) != 0 {
+		t.Errorf("expect no template applied, got %d checklists", len(checklists))
+	}
+}
@@ -1,39 +1,37 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"expvar"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"math/rand"
 	"net/http"
 	"os"
 	"strconv"
+	"text/template"
 	"time"
 
-	"github.com/setecrs/wekan-hooks/hooks/fields"
+	"github.com/setecrs/wekan-hooks/dedup"
 
 	"github.com/pkg/errors"
 
 	"github.com/setecrs/wekan-hooks/hooks"
-	"github.com/setecrs/wekan-hooks/hooks/child"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func uuid() string {
-	chars := "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	var b bytes.Buffer
-	for i := 0; i < 17; i++ {
-		b.WriteByte(chars[rand.Intn(len(chars))])
-	}
-	return b.String()
-}
+var (
+	processedEvents = expvar.NewInt("processed_events")
+	duplicateEvents = expvar.NewInt("duplicate_events")
+)
 
 type hookMsg struct {
+	ActivityId  string
 	Text        string
 	CardId      string
 	ListId      string
@@ -46,12 +44,22 @@ type hookMsg struct {
 
 type config struct {
 	MongoClient *mongo.Client
-	Hooks       []hooks.Hooker
+	Database    string
+	Hooks       []scopedHook
 	Timeout     time.Duration
+	Events      *dedup.Store
+	// Payloads dedups the events without an activity id, by a hash of the
+	// payload. Wekan sends no timestamp, so the same action repeated on the
+	// same card has the same hash, and it is kept for a shorter time.
+	Payloads *dedup.Store
+	UserID   string
+	Comments map[string]*template.Template
+	// Path and Secret authenticate the webhooks of the tenant.
+	Path   string
+	Secret string
 }
 
 func main() {
-	rand.Seed(time.Now().UTC().UnixNano())
 	PORT, ok := os.LookupEnv("PORT")
 	if !ok {
 		PORT = "80"
@@ -60,10 +68,6 @@ func main() {
 	if !ok {
 		HOST = "0.0.0.0"
 	}
-	MONGO_URL, ok := os.LookupEnv("MONGO_URL")
-	if !ok {
-		panic("MONGO_URL not set. Example: mongodb://localhost:27017")
-	}
 	t, ok := os.LookupEnv("TIMEOUT")
 	if !ok {
 		t = "20"
@@ -72,165 +76,141 @@ func main() {
 	if err != nil {
 		log.Fatalf("invalid TIMEOUT: %v, %v", t, err)
 	}
-
-	ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(MONGO_URL))
+	t, ok = os.LookupEnv("DEDUP_TTL")
+	if !ok {
+		t = "600"
+	}
+	DEDUP_TTL, err := strconv.Atoi(t)
 	if err != nil {
-		panic(err)
+		log.Fatalf("invalid DEDUP_TTL: %v, %v", t, err)
 	}
-
-	cnf := config{
-		MongoClient: client,
-		Hooks: []hooks.Hooker{
-			child.Creation,
-			child.Archive,
-			fields.IPL,
-			fields.Path,
-		},
-		Timeout: time.Duration(TIMEOUT) * time.Second,
+	// events without an activity id repeated within HASH_TTL seconds are
+	// dropped as duplicates
+	t, ok = os.LookupEnv("HASH_TTL")
+	if !ok {
+		t = "5"
 	}
-
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		defer r.Body.Close()
-		buf, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			log.Printf("error in ReadAll: %v", err)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-		data := hookMsg{}
-		err = json.Unmarshal(buf, &data)
-		if err != nil {
-			log.Printf("error in Unmarshal: %v", err)
-			return
-		}
-		err = cnf.processMsg(data)
-		if err != nil {
-			log.Printf("error in processMsg: %v", err)
-			return
-		}
-	})
-	http.ListenAndServe(fmt.Sprintf("%s:%s", HOST, PORT), nil)
-}
-
-func (cnf *config) processMsg(m hookMsg) error {
-	log.Printf("%+v\n", m)
-	switch m.Description {
-	case "act-createCard",
-		"act-archivedCard",
-		hooks.ActMoveCard:
-		for _, h := range cnf.Hooks {
-			err := h(m.Description, m.CardId, cnf)
-			if err != nil {
-				return err
-			}
-		}
+	HASH_TTL, err := strconv.Atoi(t)
+	if err != nil {
+		log.Fatalf("invalid HASH_TTL: %v, %v", t, err)
 	}
-	return nil
-}
-
-func (cnf *config) findChecklist(cardID, checklistTitle string) (id string, ok bool, err error) {
-	coll := cnf.MongoClient.Database("wekan").Collection("checklists")
-	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
-	defer cancel()
-	result := coll.FindOne(ctx, bson.M{"cardId": cardID, "title": checklistTitle})
-	idStruct := struct {
-		ID string `bson:"_id"`
-	}{}
-	err = result.Decode(&idStruct)
+	// the metrics are served only on METRICS_PORT, apart from the webhooks
+	METRICS_PORT := os.Getenv("METRICS_PORT")
+	tenants, err := loadTenants(os.Getenv("TENANTS"))
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return "", false, nil
-		}
-		return "", false, err
+		log.Fatal(err)
 	}
-	return idStruct.ID, true, nil
-}
 
-func (cnf *config) insertChecklist(cardID, checklistTitle string) (id string, err error) {
-	coll := cnf.MongoClient.Database("wekan").Collection("checklists")
-	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
-	defer cancel()
-	id = uuid()
-	_, err = coll.InsertOne(ctx, bson.M{"_id": id, "cardId": cardID, "title": checklistTitle})
-	if err != nil {
+	srv := server{}
+	for _, tn := range tenants {
+		cnf, err := tn.connect(time.Duration(TIMEOUT)*time.Second, time.Duration(DEDUP_TTL)*time.Second, time.Duration(HASH_TTL)*time.Second)
 		if err != nil {
-			return "", errors.Wrap(err, "error inserting new checklist")
+			log.Fatalf("tenant %s: %v", tn.Name, err)
 		}
+		srv[tn.Name] = cnf
 	}
-	return id, nil
-}
 
-func (cnf *config) findChecklistItem(cardID, checklistID, itemTitle string) (id string, ok bool, err error) {
-	coll := cnf.MongoClient.Database("wekan").Collection("checklistItems")
-	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
-	defer cancel()
-	result := coll.FindOne(ctx, bson.M{"cardId": cardID, "checklistId": checklistID, "title": itemTitle})
-	idStruct := struct {
-		ID string `bson:"_id"`
-	}{}
-	err = result.Decode(&idStruct)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return "", false, nil
+	if len(os.Args) > 1 {
+		cnf, err := srv.command(os.Getenv("TENANT"))
+		if err != nil {
+			log.Fatal(err)
 		}
-		return "", false, err
-	}
-	return idStruct.ID, true, nil
-}
-
-func (cnf *config) insertChecklistItem(cardID, checklistID, itemTitle string, isFinished bool) (id string, err error) {
-	coll := cnf.MongoClient.Database("wekan").Collection("checklistItems")
-	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
-	defer cancel()
-	id = uuid()
-	_, err = coll.InsertOne(ctx, bson.M{"_id": id, "cardId": cardID, "checklistId": checklistID, "title": itemTitle, "isFinished": isFinished})
-	if err != nil {
+		err = cnf.runCommand(os.Args[1], os.Args[2:])
 		if err != nil {
-			return "", errors.Wrap(err, "error inserting new checklistItem")
+			log.Fatalf("%s: %v", os.Args[1], err)
 		}
+		return
 	}
-	return id, nil
-}
 
-func (cnf *config) updateChecklistItem(id string, isFinished bool) error {
-	coll := cnf.MongoClient.Database("wekan").Collection("checklistItems")
-	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
-	defer cancel()
-	_, err := coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"isFinished": isFinished}})
-	if err != nil {
-		if err != nil {
-			return errors.Wrap(err, "error updating checklistItem")
-		}
+	if METRICS_PORT != "" {
+		go func() {
+			err := http.ListenAndServe(fmt.Sprintf("%s:%s", HOST, METRICS_PORT), expvar.Handler())
+			log.Fatalf("metrics: %v", err)
+		}()
 	}
-	return nil
+	// expvar registers /debug/vars in the default mux, which is not served
+	mux := http.NewServeMux()
+	mux.Handle("/", srv)
+	http.ListenAndServe(fmt.Sprintf("%s:%s", HOST, PORT), mux)
 }
 
-func (cnf config) SetCheckListItem(cardID string, checklistTitle string, itemTitle string, isFinished bool) error {
-	chklstID, ok, err := cnf.findChecklist(cardID, checklistTitle)
+// handle processes a webhook sent to the tenant.
+func (cnf *config) handle(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	buf, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return errors.Wrap(err, "error finding checklist")
+		log.Printf("error in ReadAll: %v", err)
+		return
 	}
-	if !ok {
-		chklstID, err = cnf.insertChecklist(cardID, checklistTitle)
-	}
-	itemID, ok, err := cnf.findChecklistItem(cardID, chklstID, itemTitle)
+	w.WriteHeader(http.StatusOK)
+	data := hookMsg{}
+	err = json.Unmarshal(buf, &data)
 	if err != nil {
-		return errors.Wrap(err, "error finding checklistItem")
+		log.Printf("error in Unmarshal: %v", err)
+		return
 	}
-	if !ok {
-		itemID, err = cnf.insertChecklistItem(cardID, chklstID, itemTitle, isFinished)
-		return errors.Wrap(err, "error inserting checklistItem")
+	id, events := data.ActivityId, cnf.Events
+	if id == "" {
+		id, events = payloadID(buf), cnf.Payloads
+	}
+	if !events.Claim(id) {
+		duplicateEvents.Add(1)
+		log.Printf("skipping duplicate event %s", id)
+		return
 	}
-	err = cnf.updateChecklistItem(itemID, isFinished)
+	err = cnf.processMsg(data)
 	if err != nil {
-		return errors.Wrap(err, "error updating checklistItem")
+		events.Release(id)
+		log.Printf("error in processMsg: %v", err)
+		return
+	}
+	processedEvents.Add(1)
+}
+
+// payloadID identifies an event without an activity id by a hash of its
+// payload.
+func payloadID(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+func (cnf *config) processMsg(m hookMsg) error {
+	log.Printf("%+v\n", m)
+	switch m.Description {
+	case hooks.ActCreateCard,
+		hooks.ActArchivedCard,
+		hooks.ActRestoredCard,
+		hooks.ActDeleteCard,
+		hooks.ActMoveCard,
+		hooks.ActAddChecklist,
+		hooks.ActAddChecklistItem,
+		hooks.ActAddedLabel,
+		hooks.ActSetCustomField,
+		hooks.ActCreateCustomField,
+		hooks.ActRemoveChecklist,
+		hooks.ActCompleteChecklist,
+		hooks.ActUncompleteChecklist,
+		hooks.ActCheckedItem,
+		hooks.ActUncheckedItem:
+		for _, h := range cnf.Hooks {
+			ok, err := h.scope.matches(cnf, m)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("could not check scope of %s", h.name))
+			}
+			if !ok {
+				continue
+			}
+			err = h.hook(m.Description, m.CardId, cnf)
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
 func (cnf config) FindCard(cardID string) (hooks.CardMsg, error) {
-	coll := cnf.MongoClient.Database("wekan").Collection("cards")
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("cards")
 	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
 	defer cancel()
 	result := coll.FindOne(ctx, bson.M{"_id": cardID})
@@ -240,7 +220,7 @@ func (cnf config) FindCard(cardID string) (hooks.CardMsg, error) {
 }
 
 func (cnf config) FindBoard(title string) (id string, ok bool, err error) {
-	coll := cnf.MongoClient.Database("wekan").Collection("boards")
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("boards")
 	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
 	defer cancel()
 	result := coll.FindOne(ctx, bson.M{"title": title})
@@ -258,7 +238,7 @@ func (cnf config) FindBoard(title string) (id string, ok bool, err error) {
 }
 
 func (cnf config) FindCustomField(name, boardID string) (id string, ok bool, err error) {
-	coll := cnf.MongoClient.Database("wekan").Collection("customFields")
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("customFields")
 	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
 	defer cancel()
 	result := coll.FindOne(ctx, bson.M{"name": name, "boardIds": boardID})
@@ -275,32 +255,62 @@ func (cnf config) FindCustomField(name, boardID string) (id string, ok bool, err
 	return idStruct.ID, true, nil
 }
 
+func (cnf config) FindCustomFieldByID(fieldID string) (field hooks.CustomField, ok bool, err error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("customFields")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	err = coll.FindOne(ctx, bson.M{"_id": fieldID}).Decode(&field)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return field, false, nil
+		}
+		return field, false, err
+	}
+	return field, true, nil
+}
+
+// SetCustomField converts value to the type of the custom field, resolving
+// dropdown labels to option IDs, and sets it in the card.
 func (cnf config) SetCustomField(cardID, fieldID, value string) error {
-	card, err := cnf.FindCard(cardID)
+	def, ok, err := cnf.FindCustomFieldByID(fieldID)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not find custom field: %s", fieldID))
+	}
+	if !ok {
+		return fmt.Errorf("custom field not found: %s", fieldID)
+	}
+	v, err := def.Parse(value)
 	if err != nil {
 		return err
 	}
+	return cnf.SetCustomFieldValue(cardID, fieldID, v)
+}
 
-	coll := cnf.MongoClient.Database("wekan").Collection("cards")
+// SetCustomFieldValue sets the value of a custom field in a card. The update
+// is done in a single ordered bulk write: the first operation changes the
+// value if the field is already present, the second one pushes the field
+// only if it is still absent, so concurrent writers never produce duplicate
+// entries.
+func (cnf config) SetCustomFieldValue(cardID, fieldID string, value interface{}) error {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("cards")
 	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
 	defer cancel()
 
-	for i, k := range card.CustomFields {
-		if k.ID == fieldID {
-			key := fmt.Sprintf("customFields.%d.value", i)
-			fmt.Println("found key", key)
-			_, err := coll.UpdateOne(
-				ctx,
-				bson.M{"_id": cardID},
-				bson.M{"$set": bson.M{key: value}},
-			)
-			return err
-		}
+	models := []mongo.WriteModel{
+		mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": cardID, "customFields._id": fieldID}).
+			SetUpdate(bson.M{"$set": bson.M{"customFields.$[cf].value": value}}).
+			SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"cf._id": fieldID}}}),
+		mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": cardID, "customFields._id": bson.M{"$ne": fieldID}}).
+			SetUpdate(bson.M{"$push": bson.M{"customFields": bson.M{"_id": fieldID, "value": value}}}),
+	}
+	result, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(true))
+	if err != nil {
+		return errors.Wrap(err, "error updating custom field")
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("card not found: %s", cardID)
 	}
-	_, err = coll.UpdateOne(
-		ctx,
-		bson.M{"_id": cardID},
-		bson.M{"$push": bson.M{"customFields": bson.M{"_id": fieldID, "value": value}}},
-	)
-	return err
+	return nil
 }
@@ -0,0 +1,28 @@
+package random
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+// Chars is the alphabet used by Meteor's Random.id, without characters that
+// are easy to confuse (0, 1, I, O, U, l, ...).
+const Chars = "23456789ABCDEFGHJKLMNPQRSTWXYZabcdefghijkmnopqrstuvwxyz"
+
+// IDLength is the length of the ids generated by Meteor's Random.id.
+const IDLength = 17
+
+// ID returns a new document id in the same format Wekan uses, read from
+// crypto/rand so ids do not collide between replicas.
+func ID() string {
+	b := make([]byte, IDLength)
+	max := big.NewInt(int64(len(Chars)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = Chars[n.Int64()]
+	}
+	return string(b)
+}
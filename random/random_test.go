@@ -0,0 +1,31 @@
+package random
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIDFormat(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		id := ID()
+		if len(id) != IDLength {
+			t.Fatalf("expect length %d, got %d: '%s'", IDLength, len(id), id)
+		}
+		for _, c := range id {
+			if !strings.ContainsRune(Chars, c) {
+				t.Fatalf("unexpected char '%c' in '%s'", c, id)
+			}
+		}
+	}
+}
+
+func TestIDUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100000; i++ {
+		id := ID()
+		if seen[id] {
+			t.Fatalf("duplicate id: '%s'", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type customFieldEntry struct {
+	ID    string      `bson:"_id"`
+	Value interface{} `bson:"value"`
+}
+
+func (cnf *config) runCommand(name string, args []string) error {
+	switch name {
+	case "dedup-custom-fields":
+		return cnf.dedupCustomFieldsCmd(args)
+	case "path-collisions":
+		return cnf.pathCollisionsCmd(args)
+	}
+	return fmt.Errorf("unknown command: %s", name)
+}
+
+// dedupCustomFieldsCmd finds cards with more than one entry for the same
+// custom field and rewrites their customFields array without duplicates.
+func (cnf *config) dedupCustomFieldsCmd(args []string) error {
+	fs := flag.NewFlagSet("dedup-custom-fields", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only report the cards that would be changed")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("cards")
+	ctx := context.Background()
+	cur, err := coll.Find(ctx, bson.M{"customFields.1": bson.M{"$exists": true}})
+	if err != nil {
+		return errors.Wrap(err, "error searching cards")
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		card := struct {
+			ID           string             `bson:"_id"`
+			CustomFields []customFieldEntry `bson:"customFields"`
+		}{}
+		err = cur.Decode(&card)
+		if err != nil {
+			return errors.Wrap(err, "error decoding card")
+		}
+		fields, changed := dedupCustomFields(card.CustomFields)
+		if !changed {
+			continue
+		}
+		log.Printf("card %s: %d custom field entries, %d after dedup", card.ID, len(card.CustomFields), len(fields))
+		if *dryRun {
+			continue
+		}
+		err = cnf.replaceCustomFields(card.ID, card.CustomFields, fields)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("error fixing card %s", card.ID))
+		}
+	}
+	return cur.Err()
+}
+
+// replaceCustomFields overwrites the customFields array of a card, but only
+// if it was not changed since it was read.
+func (cnf *config) replaceCustomFields(cardID string, old, fields []customFieldEntry) error {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("cards")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	result, err := coll.UpdateOne(
+		ctx,
+		bson.M{"_id": cardID, "customFields": old},
+		bson.M{"$set": bson.M{"customFields": fields}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("card %s was modified concurrently, run again", cardID)
+	}
+	return nil
+}
+
+// dedupCustomFields keeps one entry per custom field, at the position of its
+// first occurrence. Wekan shows the first entry, so its value is kept unless
+// it is empty and a later duplicate has a value.
+func dedupCustomFields(fields []customFieldEntry) ([]customFieldEntry, bool) {
+	index := make(map[string]int)
+	result := []customFieldEntry{}
+	for _, f := range fields {
+		i, ok := index[f.ID]
+		if !ok {
+			index[f.ID] = len(result)
+			result = append(result, f)
+			continue
+		}
+		if isEmptyValue(result[i].Value) && !isEmptyValue(f.Value) {
+			result[i].Value = f.Value
+		}
+	}
+	return result, len(result) != len(fields)
+}
+
+func isEmptyValue(v interface{}) bool {
+	return v == nil || fmt.Sprintf("%v", v) == ""
+}
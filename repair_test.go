@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDedupCustomFields(t *testing.T) {
+	table := []struct {
+		input   []customFieldEntry
+		expect  []customFieldEntry
+		changed bool
+	}{
+		{
+			[]customFieldEntry{{"a", "1"}, {"b", "2"}},
+			[]customFieldEntry{{"a", "1"}, {"b", "2"}},
+			false,
+		},
+		{
+			[]customFieldEntry{{"a", "1"}, {"b", "2"}, {"a", "3"}},
+			[]customFieldEntry{{"a", "1"}, {"b", "2"}},
+			true,
+		},
+		{
+			[]customFieldEntry{{"a", nil}, {"b", "2"}, {"a", "3"}},
+			[]customFieldEntry{{"a", "3"}, {"b", "2"}},
+			true,
+		},
+		{
+			[]customFieldEntry{{"a", ""}, {"a", nil}},
+			[]customFieldEntry{{"a", ""}},
+			true,
+		},
+	}
+	for _, tt := range table {
+		got, changed := dedupCustomFields(tt.input)
+		if !reflect.DeepEqual(got, tt.expect) || changed != tt.changed {
+			t.Errorf("input: %v, expect: %v %v, got %v %v", tt.input, tt.expect, tt.changed, got, changed)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// pathCollisionsCmd lists the paths used by more than one card in a board.
+func (cnf *config) pathCollisionsCmd(args []string) error {
+	fs := flag.NewFlagSet("path-collisions", flag.ContinueOnError)
+	board := fs.String("board", "Materiais", "title of the board")
+	field := fs.String("field", "path", "name of the custom field with the path")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	boardID, ok, err := cnf.FindBoard(*board)
+	if err != nil {
+		return errors.Wrap(err, "error searching board")
+	}
+	if !ok {
+		return fmt.Errorf("board not found: %s", *board)
+	}
+	fieldID, ok, err := cnf.FindCustomField(*field, boardID)
+	if err != nil {
+		return errors.Wrap(err, "error searching custom field")
+	}
+	if !ok {
+		return fmt.Errorf("custom field not found: %s", *field)
+	}
+
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("cards")
+	ctx := context.Background()
+	cur, err := coll.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"boardId": boardID}},
+		{"$unwind": "$customFields"},
+		{"$match": bson.M{"customFields._id": fieldID, "customFields.value": bson.M{"$nin": []interface{}{nil, ""}}}},
+		{"$group": bson.M{
+			"_id":   "$customFields.value",
+			"count": bson.M{"$sum": 1},
+			"cards": bson.M{"$push": bson.M{"_id": "$_id", "title": "$title", "archived": "$archived"}},
+		}},
+		{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+		{"$sort": bson.M{"_id": 1}},
+	})
+	if err != nil {
+		return errors.Wrap(err, "error searching paths")
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		group := struct {
+			Path  string `bson:"_id"`
+			Cards []struct {
+				ID       string `bson:"_id"`
+				Title    string `bson:"title"`
+				Archived bool   `bson:"archived"`
+			} `bson:"cards"`
+		}{}
+		err = cur.Decode(&group)
+		if err != nil {
+			return errors.Wrap(err, "error decoding paths")
+		}
+		fmt.Println(group.Path)
+		for _, c := range group.Cards {
+			archived := ""
+			if c.Archived {
+				archived = " (archived)"
+			}
+			fmt.Printf("\t%s\t%s%s\n", c.ID, c.Title, archived)
+		}
+	}
+	return cur.Err()
+}
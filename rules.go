@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"github.com/setecrs/wekan-hooks/hooks"
+	"github.com/setecrs/wekan-hooks/hooks/child"
+	"github.com/setecrs/wekan-hooks/hooks/fields"
+	"github.com/setecrs/wekan-hooks/hooks/templates"
+)
+
+// rulesConfig holds the optional rules, read from the JSON file named by the
+// CONFIG environment variable.
+type rulesConfig struct {
+	// DoneItem is the item of the parent checklist checked when the child
+	// card is archived. It is the last stage if Stages are set.
+	DoneItem       string                     `json:"doneItem"`
+	MoveParent     *child.MoveParentRule      `json:"moveParent"`
+	Stages         []child.Stage              `json:"stages"`
+	CreateChildren []child.CreateChildrenRule `json:"createChildren"`
+	Inherit        []fields.InheritRule       `json:"inherit"`
+	LinkParent     []child.LinkParentRule     `json:"linkParent"`
+	Templates      []templates.Rule           `json:"templates"`
+	PathCollision  string                     `json:"pathCollision"`
+	// Comments are the templates of the comments posted by the hooks, by
+	// name. See hooks.Comment.
+	Comments map[string]string `json:"comments"`
+	// Scopes restrict the hooks, by name, to some boards, lists and
+	// swimlanes. They replace the default scopes.
+	Scopes map[string]Scope `json:"scopes"`
+}
+
+// defaultScopes are used for the hooks without a scope in the rules.
+var defaultScopes = map[string]Scope{
+	"ipl":  {Boards: []string{"Materiais"}},
+	"path": {Boards: []string{"Materiais"}},
+}
+
+func loadRules(path string) (rulesConfig, error) {
+	rules := rulesConfig{}
+	if path == "" {
+		return rules, nil
+	}
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return rules, errors.Wrap(err, "error reading config")
+	}
+	err = json.Unmarshal(buf, &rules)
+	if err != nil {
+		return rules, errors.Wrap(err, "error parsing config")
+	}
+	switch rules.PathCollision {
+	case "", fields.CollisionFlag, fields.CollisionSuffix:
+	default:
+		return rules, fmt.Errorf("invalid pathCollision: %s", rules.PathCollision)
+	}
+	if rules.DoneItem != "" && len(rules.Stages) > 0 {
+		return rules, fmt.Errorf("doneItem can not be set with stages")
+	}
+	names := make(map[string]bool)
+	for _, h := range rules.allHooks() {
+		names[h.name] = true
+	}
+	if len(rules.CreateChildren) > 0 {
+		names["createChildren"] = true
+	}
+	if len(rules.Templates) > 0 {
+		names["templates"] = true
+	}
+	for _, h := range []string{"ipl", "path"} {
+		if len(rules.scope(h).Boards) == 0 {
+			return rules, fmt.Errorf("scope of %s must name its boards", h)
+		}
+	}
+	for name := range rules.Scopes {
+		if !names[name] {
+			return rules, fmt.Errorf("scope of unknown or disabled hook: %s", name)
+		}
+	}
+	return rules, nil
+}
+
+// allHooks returns the hooks that always run, followed by the hooks enabled
+// by the rules and by the rollup, each one with its scope.
+func (rules rulesConfig) allHooks() []scopedHook {
+	boards := append(append([]string{}, rules.scope("ipl").Boards...), rules.scope("path").Boards...)
+	m := fields.NewMateriais(boards, rules.PathCollision)
+	t := rules.tracker()
+	reparent := t.Reparent
+	if len(rules.Inherit) > 0 {
+		reparent = t.OnReparent(fields.Reinherit(rules.Inherit))
+	}
+	result := []scopedHook{
+		rules.scoped("refresh", m.Refresh),
+		rules.scoped("deletion", t.Deletion),
+		rules.scoped("reparent", reparent),
+		rules.scoped("creation", t.Creation),
+		rules.scoped("archive", t.Archive),
+		rules.scoped("restore", t.Restore),
+		rules.scoped("rename", child.Rename),
+		rules.scoped("ipl", m.IPL),
+		rules.scoped("path", m.Path),
+	}
+	result = append(result, rules.enabledHooks()...)
+	// the progress counts the items set by the other hooks
+	return append(result, rules.scoped("rollup", t.Rollup))
+}
+
+// enabledHooks returns the hooks enabled by the rules.
+func (rules rulesConfig) enabledHooks() []scopedHook {
+	t := rules.tracker()
+	result := []scopedHook{}
+	if len(rules.LinkParent) > 0 {
+		result = append(result, rules.scoped("linkParent", t.LinkParent(rules.LinkParent)))
+	}
+	if len(rules.Stages) > 0 {
+		result = append(result, rules.scoped("stages", child.Stages(rules.Stages)))
+	}
+	// after stages, which check the done item on moves
+	if rules.MoveParent != nil {
+		result = append(result, rules.scoped("moveParent", t.MoveParent(*rules.MoveParent)))
+	}
+	for i, rule := range rules.CreateChildren {
+		result = append(result, rules.scopedRule("createChildren", i, t.CreateChildren(rule)))
+	}
+	if len(rules.Inherit) > 0 {
+		result = append(result, rules.scoped("inherit", fields.Inherit(rules.Inherit)))
+	}
+	for i, rule := range rules.Templates {
+		result = append(result, rules.scopedRule("templates", i, templates.Apply(rule)))
+	}
+	return result
+}
+
+// tracker returns the hooks of the parent checklists, with the configured
+// items.
+func (rules rulesConfig) tracker() child.Tracker {
+	return child.NewTracker(rules.DoneItem, rules.Stages)
+}
+
+func (rules rulesConfig) scoped(name string, hook hooks.Hooker) scopedHook {
+	return scopedHook{name: name, hook: hook, scope: newScopeIDs(rules.scope(name))}
+}
+
+// scopedRule binds the rule at index i of a list of rules. Its scope is
+// named like "createChildren[0]", and defaults to the scope of the list,
+// named like "createChildren".
+func (rules rulesConfig) scopedRule(list string, i int, hook hooks.Hooker) scopedHook {
+	name := fmt.Sprintf("%s[%d]", list, i)
+	s, ok := rules.Scopes[name]
+	if !ok {
+		s = rules.scope(list)
+	}
+	return scopedHook{name: name, hook: hook, scope: newScopeIDs(s)}
+}
+
+func (rules rulesConfig) scope(name string) Scope {
+	s, ok := rules.Scopes[name]
+	if !ok {
+		s = defaultScopes[name]
+	}
+	return s
+}
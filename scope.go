@@ -0,0 +1,119 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/setecrs/wekan-hooks/hooks"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// scopeTTL is how long the IDs of the boards, lists and swimlanes of a
+// scope are kept before being searched again.
+const scopeTTL = 10 * time.Minute
+
+// Scope restricts a hook to the events of some boards and, optionally, some
+// lists and swimlanes, given by title or ID. Empty fields match any event.
+type Scope struct {
+	Boards    []string `json:"boards"`
+	Lists     []string `json:"lists"`
+	Swimlanes []string `json:"swimlanes"`
+}
+
+func (s Scope) empty() bool {
+	return len(s.Boards) == 0 && len(s.Lists) == 0 && len(s.Swimlanes) == 0
+}
+
+// scopedHook is a hook that only receives the events of its scope.
+type scopedHook struct {
+	name  string
+	hook  hooks.Hooker
+	scope *scopeIDs
+}
+
+// scopeIDs caches the IDs of the boards, lists and swimlanes of a scope. It
+// is safe for concurrent use.
+type scopeIDs struct {
+	Scope
+	mu        sync.Mutex
+	now       func() time.Time
+	expires   time.Time
+	boards    map[string]bool
+	lists     map[string]bool
+	swimlanes map[string]bool
+}
+
+func newScopeIDs(s Scope) *scopeIDs {
+	return &scopeIDs{Scope: s, now: time.Now}
+}
+
+// matches reports whether the event is in the scope. The IDs sent by Wekan
+// are compared, so unrelated events are skipped without reading the cards.
+func (s *scopeIDs) matches(cnf *config, m hookMsg) (bool, error) {
+	if s == nil || s.empty() {
+		return true, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.boards == nil || !s.now().Before(s.expires) {
+		err := s.resolve(cnf)
+		if err != nil {
+			return false, err
+		}
+	}
+	return (len(s.Boards) == 0 || s.boards[m.BoardId]) &&
+		(len(s.Lists) == 0 || s.lists[m.ListId]) &&
+		(len(s.Swimlanes) == 0 || s.swimlanes[m.SwimlaneId]), nil
+}
+
+// resolve searches the IDs of the titles in the scope. Lists and swimlanes
+// are searched in the boards of the scope, if any.
+func (s *scopeIDs) resolve(cnf *config) error {
+	boards, err := cnf.scopeIDs("boards", s.Boards, nil)
+	if err != nil {
+		return errors.Wrap(err, "error searching boards")
+	}
+	var boardIDs []string
+	if len(s.Boards) > 0 {
+		boardIDs = []string{}
+		for id := range boards {
+			boardIDs = append(boardIDs, id)
+		}
+	}
+	lists, err := cnf.scopeIDs("lists", s.Lists, boardIDs)
+	if err != nil {
+		return errors.Wrap(err, "error searching lists")
+	}
+	swimlanes, err := cnf.scopeIDs("swimlanes", s.Swimlanes, boardIDs)
+	if err != nil {
+		return errors.Wrap(err, "error searching swimlanes")
+	}
+	s.boards, s.lists, s.swimlanes = boards, lists, swimlanes
+	s.expires = s.now().Add(scopeTTL)
+	return nil
+}
+
+// scopeIDs returns the IDs of the documents of collection with the given
+// titles or IDs, restricted to boardIDs if not nil.
+func (cnf config) scopeIDs(collection string, titles []string, boardIDs []string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	if len(titles) == 0 {
+		return result, nil
+	}
+	filter := bson.M{"$or": []bson.M{
+		{"_id": bson.M{"$in": titles}},
+		{"title": bson.M{"$in": titles}},
+	}}
+	if boardIDs != nil {
+		filter["boardId"] = bson.M{"$in": boardIDs}
+	}
+	ids, err := cnf.findIDs(collection, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		result[id] = true
+	}
+	return result, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/setecrs/wekan-hooks/hooks/child"
+)
+
+func TestScopeMatches(t *testing.T) {
+	s := newScopeIDs(Scope{Boards: []string{"Materiais"}, Lists: []string{"Entrada"}})
+	s.boards = map[string]bool{"b1": true}
+	s.lists = map[string]bool{"l1": true}
+	s.swimlanes = map[string]bool{}
+	s.expires = time.Now().Add(time.Minute)
+	table := []struct {
+		msg    hookMsg
+		expect bool
+	}{
+		{hookMsg{BoardId: "b1", ListId: "l1", SwimlaneId: "s1"}, true},
+		{hookMsg{BoardId: "b1", ListId: "l2"}, false},
+		{hookMsg{BoardId: "b2", ListId: "l1"}, false},
+		{hookMsg{BoardId: "b1"}, false},
+	}
+	for _, x := range table {
+		// a nil config shows that the cached IDs are used
+		got, err := s.matches(nil, x.msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != x.expect {
+			t.Errorf("matches(%+v): expect %v, got %v", x.msg, x.expect, got)
+		}
+	}
+
+	var global *scopeIDs
+	if ok, _ := global.matches(nil, hookMsg{BoardId: "b2"}); !ok {
+		t.Errorf("expect hook without scope to match any event")
+	}
+	if ok, _ := newScopeIDs(Scope{}).matches(nil, hookMsg{BoardId: "b2"}); !ok {
+		t.Errorf("expect empty scope to match any event")
+	}
+}
+
+func TestScopeNames(t *testing.T) {
+	rules := rulesConfig{Scopes: map[string]Scope{"path": {Boards: []string{"Outro"}}}}
+	for _, h := range rules.allHooks() {
+		switch h.name {
+		case "path":
+			if h.scope.Boards[0] != "Outro" {
+				t.Errorf("expect configured scope of path, got %v", h.scope.Boards)
+			}
+		case "ipl":
+			if h.scope.Boards[0] != "Materiais" {
+				t.Errorf("expect default scope of ipl, got %v", h.scope.Boards)
+			}
+		}
+	}
+}
+
+func TestScopeRules(t *testing.T) {
+	rules := rulesConfig{
+		CreateChildren: []child.CreateChildrenRule{{Checklist: "a"}, {Checklist: "b"}},
+		Scopes: map[string]Scope{
+			"createChildren":    {Boards: []string{"Registros"}},
+			"createChildren[1]": {Boards: []string{"IPLs"}},
+		},
+	}
+	got := map[string]string{}
+	for _, h := range rules.enabledHooks() {
+		got[h.name] = h.scope.Boards[0]
+	}
+	expect := map[string]string{"createChildren[0]": "Registros", "createChildren[1]": "IPLs"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect %v, got %v", expect, got)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/setecrs/wekan-hooks/dedup"
+	"github.com/setecrs/wekan-hooks/hooks"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// tenant is a Wekan instance served by this service, read from the JSON
+// file named by the TENANTS environment variable.
+type tenant struct {
+	Name     string `json:"name"`
+	MongoURL string `json:"mongoUrl"`
+	// Database defaults to wekan.
+	Database string `json:"database"`
+	// Path is the URL path that receives the webhooks of the tenant. It
+	// defaults to /<name>.
+	Path string `json:"path"`
+	// Secret, if set, must be sent in the secret query parameter or in the
+	// X-Wekan-Secret header.
+	Secret string `json:"secret"`
+	// Config is the path of the rules file.
+	Config    string `json:"config"`
+	BotUserID string `json:"botUserId"`
+}
+
+// TenantHeader selects the tenant by name, instead of by the URL path.
+const TenantHeader = "X-Wekan-Tenant"
+
+// SecretHeader carries the secret of the tenant.
+const SecretHeader = "X-Wekan-Secret"
+
+// loadTenants reads the tenants from path. Without a file, the only tenant
+// is configured by the MONGO_URL, DATABASE, SECRET, CONFIG and BOT_USER_ID
+// environment variables, and receives the webhooks sent to any path.
+func loadTenants(path string) ([]tenant, error) {
+	if path == "" {
+		MONGO_URL, ok := os.LookupEnv("MONGO_URL")
+		if !ok {
+			return nil, fmt.Errorf("MONGO_URL not set. Example: mongodb://localhost:27017")
+		}
+		return []tenant{{
+			Name:      "default",
+			MongoURL:  MONGO_URL,
+			Database:  os.Getenv("DATABASE"),
+			Secret:    os.Getenv("SECRET"),
+			Config:    os.Getenv("CONFIG"),
+			BotUserID: os.Getenv("BOT_USER_ID"),
+		}}, nil
+	}
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading tenants")
+	}
+	tenants := []tenant{}
+	err = json.Unmarshal(buf, &tenants)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing tenants")
+	}
+	if len(tenants) == 0 {
+		return nil, fmt.Errorf("no tenants in %s", path)
+	}
+	names := make(map[string]bool)
+	paths := make(map[string]bool)
+	for i := range tenants {
+		t := &tenants[i]
+		if t.Name == "" || t.MongoURL == "" {
+			return nil, fmt.Errorf("tenant %d: name and mongoUrl are required", i)
+		}
+		if t.Path == "" {
+			t.Path = "/" + t.Name
+		}
+		if names[t.Name] || paths[t.Path] {
+			return nil, fmt.Errorf("tenant %s: repeated name or path", t.Name)
+		}
+		names[t.Name] = true
+		paths[t.Path] = true
+	}
+	return tenants, nil
+}
+
+// connect loads the rules of the tenant and connects to its database.
+func (t tenant) connect(timeout, dedupTTL, hashTTL time.Duration) (*config, error) {
+	rules, err := loadRules(t.Config)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules.Comments) > 0 && t.BotUserID == "" {
+		// the comments would be posted as the authors of the cards
+		return nil, fmt.Errorf("comments require botUserId")
+	}
+	comments, err := hooks.ParseComments(rules.Comments)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(t.MongoURL))
+	if err != nil {
+		return nil, errors.Wrap(err, "error connecting to mongo")
+	}
+	database := t.Database
+	if database == "" {
+		database = "wekan"
+	}
+	return &config{
+		MongoClient: client,
+		Database:    database,
+		Hooks:       rules.allHooks(),
+		Timeout:     timeout,
+		Events:      dedup.New(dedupTTL),
+		Payloads:    dedup.New(hashTTL),
+		UserID:      t.BotUserID,
+		Comments:    comments,
+		Path:        t.Path,
+		Secret:      t.Secret,
+	}, nil
+}
+
+// server routes the webhooks to the tenants, by name.
+type server map[string]*config
+
+func (srv server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cnf, ok := srv.route(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	secret := r.URL.Query().Get("secret")
+	if secret == "" {
+		secret = r.Header.Get(SecretHeader)
+	}
+	if cnf.Secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(cnf.Secret)) != 1 {
+		http.Error(w, "invalid secret", http.StatusForbidden)
+		return
+	}
+	cnf.handle(w, r)
+}
+
+// route finds the tenant named in the TenantHeader, or the one with the
+// path of the request. A tenant without path receives any request.
+func (srv server) route(r *http.Request) (*config, bool) {
+	if name := r.Header.Get(TenantHeader); name != "" {
+		cnf, ok := srv[name]
+		return cnf, ok
+	}
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	for _, cnf := range srv {
+		if cnf.Path == "" || strings.TrimSuffix(cnf.Path, "/") == path {
+			return cnf, true
+		}
+	}
+	return nil, false
+}
+
+// command returns the tenant the commands run on: the one named, or the
+// only one.
+func (srv server) command(name string) (*config, error) {
+	if name != "" {
+		cnf, ok := srv[name]
+		if !ok {
+			return nil, fmt.Errorf("tenant not found: %s", name)
+		}
+		return cnf, nil
+	}
+	if len(srv) != 1 {
+		names := []string{}
+		for n := range srv {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("set TENANT to one of: %s", strings.Join(names, ", "))
+	}
+	for _, cnf := range srv {
+		return cnf, nil
+	}
+	return nil, nil
+}
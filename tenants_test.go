@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLoadTenants(t *testing.T) {
+	f, err := ioutil.TempFile("", "tenants")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`[
+		{"name": "pericias", "mongoUrl": "mongodb://a", "secret": "s1"},
+		{"name": "laboratorio", "mongoUrl": "mongodb://b", "database": "lab", "path": "/lab"}
+	]`)
+	f.Close()
+
+	tenants, err := loadTenants(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tenants) != 2 || tenants[0].Path != "/pericias" || tenants[1].Path != "/lab" {
+		t.Errorf("unexpected tenants: %+v", tenants)
+	}
+}
+
+func TestLoadTenantsEnv(t *testing.T) {
+	url, ok := os.LookupEnv("MONGO_URL")
+	if ok {
+		defer os.Setenv("MONGO_URL", url)
+	}
+	os.Unsetenv("MONGO_URL")
+	_, err := loadTenants("")
+	if err == nil {
+		t.Errorf("expect error without MONGO_URL")
+	}
+}
+
+func TestRoute(t *testing.T) {
+	a := &config{Path: "/pericias"}
+	b := &config{Path: "/lab"}
+	srv := server{"pericias": a, "laboratorio": b}
+	table := []struct {
+		path   string
+		header string
+		expect *config
+	}{
+		{"/pericias", "", a},
+		{"/lab/", "", b},
+		{"/other", "laboratorio", b},
+		{"/other", "", nil},
+		{"/pericias", "unknown", nil},
+	}
+	for _, x := range table {
+		r := httptest.NewRequest("POST", x.path, nil)
+		if x.header != "" {
+			r.Header.Set(TenantHeader, x.header)
+		}
+		got, ok := srv.route(r)
+		if got != x.expect || ok != (x.expect != nil) {
+			t.Errorf("route(%s, %s): expect %v, got %v", x.path, x.header, x.expect, got)
+		}
+	}
+
+	single := server{"default": &config{}}
+	if _, ok := single.route(httptest.NewRequest("POST", "/any", nil)); !ok {
+		t.Errorf("expect tenant without path to receive any request")
+	}
+}
+
+func TestSecret(t *testing.T) {
+	srv := server{"pericias": &config{Path: "/pericias", Secret: "s1"}}
+	for _, path := range []string{"/pericias", "/pericias?secret=wrong"} {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest("POST", path, nil))
+		if w.Code != 403 {
+			t.Errorf("%s: expect 403, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestConnectComments(t *testing.T) {
+	f, err := ioutil.TempFile("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"comments": {"ambiguousParent": "{{.Title}}"}}`)
+	f.Close()
+
+	tn := tenant{Name: "pericias", MongoURL: "mongodb://a", Config: f.Name()}
+	_, err = tn.connect(time.Second, time.Second, time.Second)
+	if err == nil {
+		t.Errorf("expect error for comments without bot user")
+	}
+}
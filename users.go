@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+
+	"github.com/setecrs/wekan-hooks/hooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (cnf config) FindUser(userID string) (hooks.User, error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	user := hooks.User{}
+	err := coll.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	return user, err
+}
+
+func (cnf config) FindUserByUsername(username string) (user hooks.User, ok bool, err error) {
+	coll := cnf.MongoClient.Database(cnf.Database).Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+	err = coll.FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return hooks.User{}, false, nil
+		}
+		return hooks.User{}, false, err
+	}
+	return user, true, nil
+}